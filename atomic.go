@@ -0,0 +1,83 @@
+package ffutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// AtomicOutput makes ffmpeg write to a temporary file in the output
+// directory, which is verified with Probe and renamed to the output path
+// only if ffmpeg succeeds. Watchers of the output directory never see a
+// partial file, and failed or canceled runs leave no output behind. The
+// temporary file keeps the output extension so ffmpeg infers the same
+// muxer. With Overwrite(false), an existing output is never replaced,
+// which requires a file system that supports hard links.
+func (c *Command) AtomicOutput() *Command {
+	c.atomicOutput = true
+	return c
+}
+
+// writesAtomically reports whether the command writes its output through
+// a temporary file.
+func (c *Command) writesAtomically() bool {
+	return c.atomicOutput && c.outputPath != "" && isFileOutput(c.outputPath)
+}
+
+// isFileOutput reports whether output is a local file rather than stdout,
+// a pipe or a URL.
+func isFileOutput(output string) bool {
+	return output != "-" && !strings.HasPrefix(output, "pipe:") && !strings.Contains(output, "://")
+}
+
+// checkOutput fails if the output exists and must not be overwritten, so
+// atomic runs do not encode a file they cannot rename into place.
+func (c *Command) checkOutput() error {
+	if c.writesAtomically() && !c.overwrite && fileExists(c.outputPath) {
+		return fmt.Errorf("output %s already exists", c.outputPath)
+	}
+	return nil
+}
+
+// commitOutput verifies the temporary output tmp and moves it to path,
+// returning the probed output. Without overwrite, an output created while
+// ffmpeg ran is not replaced.
+func commitOutput(tmp, path string, overwrite bool) (*MediaInfo, error) {
+	info, err := Probe(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify output: %w", err)
+	}
+	if info.Format == "" {
+		return nil, errors.New("failed to verify output: no container format")
+	}
+
+	if err := moveOutput(tmp, path, overwrite); err != nil {
+		return nil, err
+	}
+
+	info.Path = path
+	return info, nil
+}
+
+// moveOutput renames tmp to path. Without overwrite it never replaces an
+// existing path: tmp is hard linked to path, which fails if path exists,
+// and then removed. File systems without hard links are reported as an
+// error rather than risking a replacing rename.
+func moveOutput(tmp, path string, overwrite bool) error {
+	if overwrite {
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to move output to %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := os.Link(tmp, path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("output %s already exists", path)
+		}
+		return fmt.Errorf("failed to move output to %s without overwriting: %w", path, err)
+	}
+	os.Remove(tmp)
+	return nil
+}
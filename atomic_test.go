@@ -0,0 +1,184 @@
+package ffutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeFFmpegOutput is a fake ffmpeg writing "encoded" to its last argument.
+const fakeFFmpegOutput = `for last; do :; done
+case "$last" in
+*.tmp.mp4) ;;
+*) echo "not a temp file: $last" >&2; exit 1 ;;
+esac
+printf encoded > "$last"
+`
+
+// fakeFFprobeMP4 is a fake ffprobe reporting an MP4 file.
+const fakeFFprobeMP4 = `echo '{"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "1.0"}}'`
+
+func TestAtomicOutput(t *testing.T) {
+	fakeFFmpeg(t, fakeFFmpegOutput)
+	fakeTool(t, "ffprobe", fakeFFprobeMP4)
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.mp4")
+	result, err := New().Input("in.mp4").AtomicOutput().Output(out).RunResult(context.Background())
+	if err != nil {
+		t.Fatalf("RunResult() error: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "encoded" {
+		t.Errorf("output = %q, want %q", data, "encoded")
+	}
+	if result.Output == nil || result.Output.Path != out || result.OutputSize != 7 {
+		t.Errorf("RunResult() = %+v, want the probed output at %s", result, out)
+	}
+	assertDirFiles(t, dir, "out.mp4")
+}
+
+func TestAtomicOutputFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		ffmpeg  string
+		ffprobe string
+		wantErr string
+	}{
+		{
+			name:    "ffmpeg fails",
+			ffmpeg:  fakeFFmpegOutput + "exit 1\n",
+			ffprobe: fakeFFprobeMP4,
+			wantErr: "ffmpeg failed",
+		},
+		{
+			name:    "output does not probe",
+			ffmpeg:  fakeFFmpegOutput,
+			ffprobe: "exit 1",
+			wantErr: "failed to verify output",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeFFmpeg(t, tt.ffmpeg)
+			fakeTool(t, "ffprobe", tt.ffprobe)
+
+			dir := t.TempDir()
+			out := filepath.Join(dir, "out.mp4")
+			err := New().Input("in.mp4").AtomicOutput().Output(out).Run(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			assertDirFiles(t, dir)
+		})
+	}
+}
+
+func TestAtomicOutputNoOverwrite(t *testing.T) {
+	fakeFFmpeg(t, fakeFFmpegOutput+`printf other > "$(dirname "$last")/out.mp4"`+"\n")
+	fakeTool(t, "ffprobe", fakeFFprobeMP4)
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.mp4")
+	cmd := New().Input("in.mp4").AtomicOutput().Overwrite(false).Output(out)
+
+	// An output created while ffmpeg runs is kept.
+	if err := cmd.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Run() error = %v, want output exists error", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "other" {
+		t.Errorf("output = %q, want the existing file kept", data)
+	}
+	assertDirFiles(t, dir, "out.mp4")
+
+	// An existing output fails before ffmpeg runs.
+	fakeFFmpeg(t, "echo ffmpeg should not run >&2; exit 1")
+	if _, err := cmd.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Start() error = %v, want output exists error", err)
+	}
+}
+
+func TestAtomicOutputRunWithOutput(t *testing.T) {
+	fakeFFmpeg(t, fakeFFmpegOutput+"echo encoding failed >&2; exit 1\n")
+	fakeTool(t, "ffprobe", fakeFFprobeMP4)
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.mp4")
+	output, err := New().Input("in.mp4").AtomicOutput().Output(out).RunWithOutput(context.Background())
+	if err == nil || !strings.Contains(string(output), "encoding failed") {
+		t.Fatalf("RunWithOutput() = %q, %v, want the ffmpeg failure", output, err)
+	}
+	assertDirFiles(t, dir)
+
+	fakeFFmpeg(t, fakeFFmpegOutput)
+	if _, err := New().Input("in.mp4").AtomicOutput().Output(out).RunWithOutput(context.Background()); err != nil {
+		t.Fatalf("RunWithOutput() error: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "encoded" {
+		t.Errorf("output = %q, want %q", data, "encoded")
+	}
+	assertDirFiles(t, dir, "out.mp4")
+
+	fakeFFmpeg(t, "echo ffmpeg should not run >&2; exit 1")
+	cmd := New().Input("in.mp4").AtomicOutput().Overwrite(false).Output(out)
+	if _, err := cmd.RunWithOutput(context.Background()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("RunWithOutput() error = %v, want output exists error", err)
+	}
+}
+
+// assertDirFiles checks that dir contains exactly the named files.
+func assertDirFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("files in %s = %v, want %v", dir, got, names)
+	}
+}
+
+func TestMoveOutput(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, ".out.1.tmp.mp4")
+	out := filepath.Join(dir, "out.mp4")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(tmp, "new")
+	write(out, "existing")
+	if err := moveOutput(tmp, out, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("moveOutput() without overwrite error = %v, want output exists error", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "existing" {
+		t.Errorf("output = %q, want the existing file kept", data)
+	}
+
+	if err := moveOutput(tmp, out, true); err != nil {
+		t.Fatalf("moveOutput() with overwrite error: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "new" {
+		t.Errorf("output = %q, want %q", data, "new")
+	}
+
+	// Without a source to link, moveOutput fails instead of renaming.
+	os.Remove(out)
+	if err := moveOutput(tmp, out, false); err == nil || fileExists(out) {
+		t.Errorf("moveOutput() of a missing file = %v, want an error and no output", err)
+	}
+
+	write(tmp, "linked")
+	if err := moveOutput(tmp, out, false); err != nil {
+		t.Fatalf("moveOutput() error: %v", err)
+	}
+	assertDirFiles(t, dir, "out.mp4")
+}
@@ -0,0 +1,514 @@
+package ffutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores transcode outputs in a local directory, keyed on the
+// command, the content of its inputs and the ffmpeg version, so identical
+// jobs can reuse a previous result. When the cache exceeds its size limit,
+// the least recently used entries are evicted.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	version string
+	hashes  map[fileStat]string
+}
+
+// fileStat identifies a version of a file for memoizing content hashes.
+type fileStat struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// ErrNotCacheable is returned by Cache.Key for commands that read files
+// the cache cannot identify, such as two-pass statistics or filter scripts.
+// Cache.Run runs these commands without caching.
+var ErrNotCacheable = errors.New("command reads files the cache cannot track")
+
+// NewCache creates a cache in dir, creating the directory if needed.
+// maxBytes limits the total size of cached outputs; 0 means no limit.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	return &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		hashes:   make(map[fileStat]string),
+	}, nil
+}
+
+// Run copies a cached output to the command's output path if one exists,
+// and otherwise runs the command and stores its output in the cache.
+// It reports whether the output came from the cache. Commands that do not
+// write a single local file (stdout, pipes, URLs and numbered patterns such
+// as "out_%03d.ts") and commands that are not cacheable (see
+// ErrNotCacheable) are run without caching.
+func (c *Cache) Run(ctx context.Context, cmd *Command) (cached bool, err error) {
+	if !cacheableOutput(cmd.outputPath) {
+		return false, cmd.Run(ctx)
+	}
+	if err := cmd.validateForRun(); err != nil {
+		return false, err
+	}
+
+	key, err := c.Key(cmd)
+	if errors.Is(err, ErrNotCacheable) {
+		return false, cmd.Run(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	entry := c.entryPath(key, cmd.outputPath)
+
+	if _, err := os.Stat(entry); err == nil {
+		if !cmd.overwrite && fileExists(cmd.outputPath) {
+			return false, fmt.Errorf("output %s already exists", cmd.outputPath)
+		}
+		if err := restore(entry, cmd.outputPath, cmd.overwrite); err != nil {
+			return false, err
+		}
+		now := time.Now()
+		_ = os.Chtimes(entry, now, now) // mark as recently used
+		return true, nil
+	}
+
+	if err := cmd.Run(ctx); err != nil {
+		return false, err
+	}
+	if err := c.store(cmd.outputPath, key, entry); err != nil {
+		return false, err
+	}
+	return false, c.evict()
+}
+
+// Key returns the content-addressed cache key for the command. It covers
+// the SHA-256 of each local input file and of the files read by filters
+// (such as BurnSubtitles) or named in Args, the ffmpeg version and the
+// command arguments, with input and output paths reduced to their
+// extensions and settings that do not change the output (log options and
+// thread counts) removed. It returns an error wrapping ErrNotCacheable if
+// the command reads files that cannot be identified.
+func (c *Cache) Key(cmd *Command) (string, error) {
+	version, err := c.ffmpegVersion()
+	if err != nil {
+		return "", err
+	}
+	files, err := referencedFiles(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	canonical := *cmd
+	canonical.outputPath = "output" + filepath.Ext(cmd.outputPath)
+	canonical.overwrite = true
+	canonical.logLevel, canonical.logger = "", nil
+	canonical.hideBanner, canonical.stats = false, false
+	canonical.threads, canonical.filterThreads, canonical.filterComplexThreads = 0, 0, 0
+	canonical.inputs = slices.Clone(cmd.inputs)
+	for i, in := range canonical.inputs {
+		if isLocalInput(in) {
+			canonical.inputs[i].path = fmt.Sprintf("input%d%s", i, filepath.Ext(in.path))
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(canonical.Hash()))
+	for _, in := range cmd.inputs {
+		h.Write([]byte{0})
+		if !isLocalInput(in) {
+			h.Write([]byte(in.path))
+			continue
+		}
+		sum, err := c.contentHash(in.path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(sum))
+	}
+	for _, path := range files {
+		h.Write([]byte{0})
+		sum, err := c.contentHash(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(sum))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheableOutput reports whether output is a single local file.
+func cacheableOutput(output string) bool {
+	return output != "" && isFileOutput(output) && !strings.Contains(output, "%")
+}
+
+// filterArgs are the options whose value is a filter graph.
+var filterArgs = []string{"-vf", "-af", "-filter", "-filter_complex", "-lavfi"}
+
+// untrackedArgs are options that make ffmpeg read files not named by
+// their value, or filter graphs from a file.
+var untrackedArgs = []string{"-pass", "-passlogfile", "-filter_script", "-filter_complex_script"}
+
+// referencedFiles returns the local files other than inputs that the
+// command reads: files loaded by its filters and values of Args and input
+// options naming existing files.
+func referencedFiles(cmd *Command) ([]string, error) {
+	var files []string
+	for _, graph := range []string{cmd.filterVideo, cmd.filterAudio, cmd.filterComplex} {
+		f, err := filterGraphFiles(graph)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+
+	argLists := [][]string{cmd.presetArgs, cmd.extraArgs}
+	for _, in := range cmd.inputs {
+		argLists = append(argLists, in.options)
+	}
+	for _, args := range argLists {
+		for i, arg := range args {
+			name, _, _ := strings.Cut(arg, ":")
+			if strings.HasPrefix(arg, "-/") || slices.Contains(untrackedArgs, name) {
+				return nil, fmt.Errorf("%w: %s", ErrNotCacheable, arg)
+			}
+			if i > 0 {
+				if prev, _, _ := strings.Cut(args[i-1], ":"); slices.Contains(filterArgs, prev) {
+					f, err := filterGraphFiles(arg)
+					if err != nil {
+						return nil, err
+					}
+					files = append(files, f...)
+					continue
+				}
+			}
+			if !strings.HasPrefix(arg, "-") && isRegularFile(arg) {
+				files = append(files, arg)
+			}
+		}
+	}
+	return files, nil
+}
+
+// fileFilter describes the options of a filter that name files it reads.
+type fileFilter struct {
+	// positional are the option names of unnamed values, in order
+	positional []string
+
+	// files are the options naming files
+	files []string
+}
+
+// fileFilters are the filters that read files.
+var fileFilters = map[string]fileFilter{
+	"subtitles": {positional: []string{"filename"}, files: []string{"filename", "f", "fontsdir"}},
+	"ass":       {positional: []string{"filename"}, files: []string{"filename", "f", "fontsdir"}},
+	"movie":     {positional: []string{"filename"}, files: []string{"filename"}},
+	"amovie":    {positional: []string{"filename"}, files: []string{"filename"}},
+	"lut1d":     {positional: []string{"file"}, files: []string{"file"}},
+	"lut3d":     {positional: []string{"file"}, files: []string{"file"}},
+	"sendcmd":   {positional: []string{"commands", "filename"}, files: []string{"filename", "f"}},
+	"asendcmd":  {positional: []string{"commands", "filename"}, files: []string{"filename", "f"}},
+	"drawtext":  {positional: []string{"fontfile"}, files: []string{"fontfile", "textfile"}},
+}
+
+// filterGraphFiles returns the files read by the filters of a filter
+// graph. It fails with ErrNotCacheable if the graph cannot be parsed or a
+// file option does not name a regular file.
+func filterGraphFiles(graph string) ([]string, error) {
+	var files []string
+	rest := graph
+	for {
+		rest = skipFilterLabels(rest)
+		if rest == "" {
+			return files, nil
+		}
+		var name, args string
+		name, rest = filterToken(rest, "=,;[")
+		if strings.HasPrefix(rest, "=") {
+			args, rest = filterToken(rest[1:], "[],;")
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: cannot parse filter graph %q", ErrNotCacheable, graph)
+		}
+		rest = skipFilterLabels(rest)
+		if rest != "" && strings.IndexByte(",;", rest[0]) >= 0 {
+			rest = rest[1:]
+		}
+
+		name, _, _ = strings.Cut(name, "@")
+		filter, ok := fileFilters[name]
+		if !ok {
+			continue
+		}
+		opts := filterOptions(args, filter.positional)
+		for _, key := range filter.files {
+			path, ok := opts[key]
+			if !ok {
+				continue
+			}
+			if !isRegularFile(path) {
+				return nil, fmt.Errorf("%w: %s reads %q", ErrNotCacheable, name, path)
+			}
+			files = append(files, path)
+		}
+	}
+}
+
+// skipFilterLabels skips whitespace and link labels such as "[v]".
+func skipFilterLabels(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "[") {
+			return s
+		}
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return s
+		}
+		s = s[end+1:]
+	}
+}
+
+// filterOptions parses the arguments of a filter into option values.
+// Unnamed values are assigned to the positional option names in order.
+func filterOptions(args string, positional []string) map[string]string {
+	opts := make(map[string]string)
+	for i := 0; args != ""; i++ {
+		var key, value string
+		if k, rest, ok := cutFilterKey(args); ok {
+			key = k
+			value, args = filterToken(rest, ":")
+		} else {
+			value, args = filterToken(args, ":")
+			if i < len(positional) {
+				key = positional[i]
+			}
+		}
+		if key != "" {
+			opts[key] = value
+		}
+		args = strings.TrimPrefix(args, ":")
+	}
+	return opts
+}
+
+// cutFilterKey cuts an option name followed by "=" from the start of s.
+func cutFilterKey(s string) (key, rest string, ok bool) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-/.", r))
+	})
+	if i <= 0 || s[i] != '=' {
+		return "", s, false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// filterToken reads a token up to the first unescaped, unquoted byte in
+// term, removing one level of backslash escaping and single quoting and
+// surrounding whitespace, like FFmpeg's av_get_token.
+func filterToken(s, term string) (token, rest string) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	var b strings.Builder
+	end, i := 0, 0
+	for i < len(s) && strings.IndexByte(term, s[i]) < 0 {
+		ch := s[i]
+		i++
+		switch {
+		case ch == '\\' && i < len(s):
+			b.WriteByte(s[i])
+			i++
+			end = b.Len()
+		case ch == '\'':
+			for i < len(s) && s[i] != '\'' {
+				b.WriteByte(s[i])
+				i++
+			}
+			i++ // closing quote
+			end = b.Len()
+		default:
+			b.WriteByte(ch)
+			if !strings.ContainsRune(" \t\r\n", rune(ch)) {
+				end = b.Len()
+			}
+		}
+	}
+	return b.String()[:end], s[min(i, len(s)):]
+}
+
+// isRegularFile reports whether path names an existing regular file.
+func isRegularFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (c *Cache) entryPath(key, output string) string {
+	return filepath.Join(c.dir, key+filepath.Ext(output))
+}
+
+func (c *Cache) ffmpegVersion() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == "" {
+		v, err := Version()
+		if err != nil {
+			return "", err
+		}
+		c.version = v
+	}
+	return c.version, nil
+}
+
+// contentHash returns the SHA-256 of a file's content, reusing the previous
+// result while the file's size and modification time are unchanged.
+func (c *Cache) contentHash(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat input: %w", err)
+	}
+	stat := fileStat{path: path, size: fi.Size(), modTime: fi.ModTime()}
+
+	c.mu.Lock()
+	sum, ok := c.hashes[stat]
+	c.mu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash input: %w", err)
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	c.mu.Lock()
+	c.hashes[stat] = sum
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// store copies output into the cache entry atomically. Each store uses
+// its own temporary file, so concurrent runs of the same job cannot
+// publish a mix of their outputs.
+func (c *Cache) store(output, key, entry string) error {
+	f, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	tmp := f.Name()
+	f.Close()
+	if err := copyFile(output, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, entry); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
+
+// restore copies a cache entry to a temporary file next to output and
+// renames it into place, so the output never holds a partial copy.
+func restore(entry, output string, overwrite bool) error {
+	tmp, err := tempOutputPath(output)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(entry, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := moveOutput(tmp, output, overwrite); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// evict removes the least recently used entries until the cache fits
+// within its size limit.
+func (c *Cache) evict() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []fs.FileInfo
+	var total int64
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, de := range dirEntries {
+		if de.IsDir() || strings.HasSuffix(de.Name(), ".tmp") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, fi)
+		total += fi.Size()
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	var errs []error
+	for _, fi := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		total -= fi.Size()
+	}
+	return errors.Join(errs...)
+}
+
+// copyFile copies src to dst, replacing dst if it exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,317 @@
+package ffutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, maxBytes int64) *Cache {
+	t.Helper()
+	c, err := NewCache(filepath.Join(t.TempDir(), "cache"), maxBytes)
+	if err != nil {
+		t.Fatalf("NewCache() error: %v", err)
+	}
+	c.version = "ffmpeg version test"
+	return c
+}
+
+func TestCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mp4")
+	if err := os.WriteFile(input, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCache(t, 0)
+
+	key := func(cmd *Command) string {
+		t.Helper()
+		k, err := c.Key(cmd)
+		if err != nil {
+			t.Fatalf("Key() error: %v", err)
+		}
+		return k
+	}
+
+	base := key(New().Input(input).CRF(23).Output("a/out.mp4"))
+	if got := key(New().Input(input).CRF(23).Output("b/other.mp4")); got != base {
+		t.Error("Key() should not depend on the output directory or name")
+	}
+	if got := key(New().Input(input).CRF(23).Output("out.mkv")); got == base {
+		t.Error("Key() should depend on the output extension")
+	}
+	if got := key(New().Input(input).CRF(24).Output("out.mp4")); got == base {
+		t.Error("Key() should depend on the command arguments")
+	}
+	if got := key(New().Input(input).CRF(23).LogLevel("error").HideBanner().Threads(4).Output("out.mp4")); got != base {
+		t.Error("Key() should not depend on log options or thread counts")
+	}
+
+	copied := filepath.Join(t.TempDir(), "copy.mp4")
+	if err := os.WriteFile(copied, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := key(New().Input(copied).CRF(23).Output("out.mp4")); got != base {
+		t.Error("Key() should not depend on the input path")
+	}
+
+	c.version = "ffmpeg version other"
+	if got := key(New().Input(input).CRF(23).Output("out.mp4")); got == base {
+		t.Error("Key() should depend on the ffmpeg version")
+	}
+	c.version = "ffmpeg version test"
+
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(input, []byte("two"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := key(New().Input(input).CRF(23).Output("out.mp4")); got == base {
+		t.Error("Key() should depend on the input content")
+	}
+}
+
+func TestCacheKeyReferencedFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Duration(len(data)) * time.Hour)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	input := write("in.mp4", "input")
+	subs := write("subs.srt", "one")
+	font := write("font.ttf", "font")
+	c := newTestCache(t, 0)
+
+	tests := []struct {
+		name string
+		cmd  func() *Command
+		file string
+	}{
+		{"burned subtitles", func() *Command { return New().Input(input).BurnSubtitles(subs).Output("out.mp4") }, subs},
+		{"file in Args", func() *Command { return New().Input(input).Args("-attach", font).Output("out.mkv") }, font},
+		{"filter in Args", func() *Command {
+			return New().Input(input).Args("-vf", "drawtext=fontfile="+font+":text=hi").Output("out.mp4")
+		}, font},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := c.Key(tt.cmd())
+			if err != nil {
+				t.Fatalf("Key() error: %v", err)
+			}
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			write(filepath.Base(tt.file), string(data)+"x")
+			after, err := c.Key(tt.cmd())
+			if err != nil {
+				t.Fatalf("Key() error: %v", err)
+			}
+			if after == before {
+				t.Errorf("Key() should change when %s changes", filepath.Base(tt.file))
+			}
+		})
+	}
+
+	for _, cmd := range []*Command{
+		New().Input(input).BurnSubtitles(filepath.Join(dir, "missing.srt")).Output("out.mp4"),
+		New().Input(input).Args("-pass", "2", "-passlogfile", "stats").Output("out.mp4"),
+		New().Input(input).Args("-filter_script:v", "graph.txt").Output("out.mp4"),
+	} {
+		if _, err := c.Key(cmd); !errors.Is(err, ErrNotCacheable) {
+			t.Errorf("Key(%v) error = %v, want ErrNotCacheable", cmd.Build(), err)
+		}
+	}
+}
+
+func TestFilterGraphFiles(t *testing.T) {
+	dir := t.TempDir()
+	odd := filepath.Join(dir, "it's [a]: b,c;d.srt")
+	plain := filepath.Join(dir, "cmds.txt")
+	for _, path := range []string{odd, plain} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		graph string
+		want  []string
+	}{
+		{"", nil},
+		{"scale=1280:-2,fps=30", nil},
+		{SubtitlesFilter(odd), []string{odd}},
+		{"[0:v]scale=1280:-2," + SubtitlesFilter(odd) + "[v];[1:a]anull[a]", []string{odd}},
+		{"sendcmd=c='0 drawtext reinit text=a':f=" + plain + ",drawtext@t=text=x", []string{plain}},
+		{"sendcmd='':" + plain, []string{plain}},
+		{"subtitles@burn=filename=" + plain + ":force_style='Fontsize=24'", []string{plain}},
+	}
+	for _, tt := range tests {
+		got, err := filterGraphFiles(tt.graph)
+		if err != nil {
+			t.Errorf("filterGraphFiles(%q) error: %v", tt.graph, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("filterGraphFiles(%q) = %q, want %q", tt.graph, got, tt.want)
+		}
+	}
+}
+
+func TestCacheRunUncachedOutputs(t *testing.T) {
+	fakeFFmpeg(t, `exit 0`)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mp4")
+	if err := os.WriteFile(input, []byte("input"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCache(t, 0)
+
+	for _, cmd := range []*Command{
+		New().Input(input).Output("pipe:1"),
+		New().Input(input).Output("udp://127.0.0.1:1234"),
+		New().Input(input).Args("-f", "segment").Output(filepath.Join(dir, "out_%03d.ts")),
+		New().Input(input).Args("-passlogfile", "stats").Output(filepath.Join(dir, "out.mp4")),
+	} {
+		cached, err := c.Run(context.Background(), cmd)
+		if err != nil || cached {
+			t.Errorf("Run(%v) = %v, %v, want an uncached run", cmd.Build(), cached, err)
+		}
+	}
+	assertDirFiles(t, c.dir)
+}
+
+func TestCacheRunHit(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mp4")
+	if err := os.WriteFile(input, []byte("input"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCache(t, 0)
+
+	output := filepath.Join(dir, "out.mp4")
+	cmd := New().Input(input).VideoCodec("libx264").Output(output)
+	key, err := c.Key(cmd)
+	if err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+	if err := os.WriteFile(c.entryPath(key, output), []byte("cached"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := c.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !cached {
+		t.Error("Run() cached = false, want true")
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "cached" {
+		t.Errorf("output = %q, want %q", data, "cached")
+	}
+
+	assertDirFiles(t, dir, "in.mp4", "out.mp4")
+
+	cmd.Overwrite(false)
+	if _, err := c.Run(context.Background(), cmd); err == nil {
+		t.Error("Run() should fail when the output exists and Overwrite is false")
+	}
+}
+
+func TestCacheStoreConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCache(t, 0)
+	entry := c.entryPath("key", "out.mp4")
+
+	outputs := make([]string, 8)
+	for i := range outputs {
+		outputs[i] = strings.Repeat(strconv.Itoa(i), 64<<10)
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(i)+".mp4"), []byte(outputs[i]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Go(func() {
+			if err := c.store(filepath.Join(dir, strconv.Itoa(i)+".mp4"), "key", entry); err != nil {
+				t.Errorf("store() error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(outputs, string(data)) {
+		t.Error("store() published an entry that matches no output")
+	}
+	assertDirFiles(t, c.dir, "key.mp4")
+}
+
+func TestCacheEvict(t *testing.T) {
+	c := newTestCache(t, 10)
+	now := time.Now()
+
+	entries := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"oldest.mp4", 3 * time.Hour},
+		{"older.mp4", 2 * time.Hour},
+		{"newest.mp4", time.Hour},
+	}
+	for _, e := range entries {
+		path := filepath.Join(c.dir, e.name)
+		if err := os.WriteFile(path, []byte("12345"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-e.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.evict(); err != nil {
+		t.Fatalf("evict() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"oldest.mp4", false},
+		{"older.mp4", true},
+		{"newest.mp4", true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(c.dir, tt.name))
+		if got := err == nil; got != tt.want {
+			t.Errorf("%s exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
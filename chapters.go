@@ -0,0 +1,112 @@
+package ffutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Chapter represents a chapter marker.
+type Chapter struct {
+	// ID is the chapter identifier assigned by the container
+	ID int64 `json:"id"`
+
+	// Start is the chapter start time
+	Start time.Duration `json:"start"`
+
+	// End is the chapter end time
+	End time.Duration `json:"end"`
+
+	// Title is the chapter title (empty if untitled)
+	Title string `json:"title,omitempty"`
+}
+
+// ffprobeChapter represents a chapter in ffprobe JSON output.
+type ffprobeChapter struct {
+	ID        int64             `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func (c ffprobeChapter) chapter() Chapter {
+	return Chapter{
+		ID:    c.ID,
+		Start: parseTime(c.StartTime),
+		End:   parseTime(c.EndTime),
+		Title: c.Tags["title"],
+	}
+}
+
+// ChaptersFromScenes converts scene boundaries into chapters covering the
+// whole media. Each chapter runs from one boundary to the next and is
+// titled "Chapter N".
+func ChaptersFromScenes(scenes []Scene, total time.Duration) []Chapter {
+	starts := []time.Duration{0}
+	for _, s := range scenes {
+		if s.Time > starts[len(starts)-1] && s.Time < total {
+			starts = append(starts, s.Time)
+		}
+	}
+
+	chapters := make([]Chapter, len(starts))
+	for i, start := range starts {
+		end := total
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		chapters[i] = Chapter{
+			ID:    int64(i),
+			Start: start,
+			End:   end,
+			Title: fmt.Sprintf("Chapter %d", i+1),
+		}
+	}
+	return chapters
+}
+
+// WriteFFMetadata writes global tags and chapters in the FFMETADATA format
+// read by ffmpeg's ffmetadata demuxer.
+func WriteFFMetadata(w io.Writer, tags map[string]string, chapters []Chapter) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, ";FFMETADATA1")
+
+	for _, k := range sortedKeys(tags) {
+		fmt.Fprintf(bw, "%s=%s\n", escapeFFMetadata(k), escapeFFMetadata(tags[k]))
+	}
+
+	for _, ch := range chapters {
+		fmt.Fprintln(bw, "[CHAPTER]")
+		fmt.Fprintln(bw, "TIMEBASE=1/1000")
+		fmt.Fprintf(bw, "START=%d\n", ch.Start.Milliseconds())
+		fmt.Fprintf(bw, "END=%d\n", ch.End.Milliseconds())
+		if ch.Title != "" {
+			fmt.Fprintf(bw, "title=%s\n", escapeFFMetadata(ch.Title))
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteChapterFile writes chapters to an FFMETADATA file at path, for use
+// with Command.ChapterFile.
+func WriteChapterFile(path string, chapters []Chapter) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteFFMetadata(f, nil, chapters); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// escapeFFMetadata escapes the characters with special meaning in FFMETADATA files.
+func escapeFFMetadata(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, `=`, `\=`, `;`, `\;`, `#`, `\#`, "\n", "\\\n",
+	).Replace(s)
+}
@@ -0,0 +1,75 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFfprobeChapter(t *testing.T) {
+	data := `{"chapters": [{"id": 1, "time_base": "1/1000", "start": 0, "start_time": "0.000000",
+	  "end": 90500, "end_time": "90.500000", "tags": {"title": "Intro"}}]}`
+	var output ffprobeOutput
+	if err := json.Unmarshal([]byte(data), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	got := output.Chapters[0].chapter()
+	want := Chapter{ID: 1, Start: 0, End: 90500 * time.Millisecond, Title: "Intro"}
+	if got != want {
+		t.Errorf("chapter() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChaptersFromScenes(t *testing.T) {
+	scenes := []Scene{
+		{Time: 30 * time.Second},
+		{Time: 75 * time.Second},
+	}
+	chapters := ChaptersFromScenes(scenes, 120*time.Second)
+
+	if len(chapters) != 3 {
+		t.Fatalf("ChaptersFromScenes() returned %d chapters, want 3", len(chapters))
+	}
+
+	want := Chapter{ID: 1, Start: 30 * time.Second, End: 75 * time.Second, Title: "Chapter 2"}
+	if chapters[1] != want {
+		t.Errorf("ChaptersFromScenes()[1] = %+v, want %+v", chapters[1], want)
+	}
+
+	if chapters[2].End != 120*time.Second {
+		t.Errorf("last chapter should end at total duration, got %v", chapters[2].End)
+	}
+}
+
+func TestWriteFFMetadata(t *testing.T) {
+	var sb strings.Builder
+	tags := map[string]string{"title": "Show; Episode=1", "artist": "Me"}
+	chapters := []Chapter{{Start: 0, End: 1500 * time.Millisecond, Title: "Part #1"}}
+
+	if err := WriteFFMetadata(&sb, tags, chapters); err != nil {
+		t.Fatalf("WriteFFMetadata() error: %v", err)
+	}
+
+	want := `;FFMETADATA1
+artist=Me
+title=Show\; Episode\=1
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=1500
+title=Part \#1
+`
+	if sb.String() != want {
+		t.Errorf("WriteFFMetadata() =\n%s\nwant\n%s", sb.String(), want)
+	}
+}
+
+func TestWriteChapterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chapters.txt")
+	if err := WriteChapterFile(path, []Chapter{{Start: 0, End: time.Second}}); err != nil {
+		t.Fatalf("WriteChapterFile() error: %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+// Command ffutil exposes the ffutil library on the command line.
+//
+// Usage:
+//
+//	ffutil probe [--json] FILE...
+//	ffutil encoders [--json] [--hardware]
+//	ffutil best-encoder [--json] h264|hevc
+//	ffutil thumb [-t SECONDS] [--width PIXELS] [-y] INPUT OUTPUT
+//	ffutil concat -o OUTPUT [-y] INPUT...
+//	ffutil transcode [--preset NAME] [--presets FILE] [--crf N] [--dry-run] [-y] INPUT OUTPUT
+//	ffutil doctor [--json]
+//
+// Flags must precede the positional arguments. Output is a table unless
+// --json is given.
+//
+// Exit codes: 0 on success, 1 when an operation fails, 2 for usage errors
+// and 3 when ffmpeg or ffprobe is not installed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grokify/ffutil"
+)
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitUnavailable = 3
+)
+
+const usage = `Usage: ffutil COMMAND [FLAGS] [ARGS]
+
+Commands:
+  probe         Show media file information
+  encoders      List available video encoders
+  best-encoder  Show the best available h264 or hevc encoder
+  thumb         Extract a thumbnail image
+  concat        Concatenate files without re-encoding
+  transcode     Transcode a file using a preset
+  doctor        Report the ffmpeg environment for bug reports
+
+Run "ffutil COMMAND -h" for command flags.
+`
+
+// errUnavailable is returned when ffmpeg or ffprobe is not installed.
+var errUnavailable = errors.New("not installed")
+
+// usageError is returned for invalid command-line arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type command struct {
+	name string
+	run  func(ctx context.Context, args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"probe", probeCmd},
+	{"encoders", encodersCmd},
+	{"best-encoder", bestEncoderCmd},
+	{"thumb", thumbCmd},
+	{"concat", concatCmd},
+	{"transcode", transcodeCmd},
+	{"doctor", doctorCmd},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, args[1:], stdout, stderr)
+		var uerr *usageError
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return exitOK
+		case errors.As(err, &uerr):
+			fmt.Fprintf(stderr, "ffutil %s: %v\n", cmd.name, err)
+			return exitUsage
+		case errors.Is(err, errUnavailable):
+			fmt.Fprintf(stderr, "ffutil %s: %v\n", cmd.name, err)
+			return exitUnavailable
+		default:
+			fmt.Fprintf(stderr, "ffutil %s: %v\n", cmd.name, err)
+			return exitFailure
+		}
+	}
+	fmt.Fprintf(stderr, "ffutil: unknown command %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// parseFlags parses flags and checks the number of positional arguments.
+// maxArgs < 0 allows any number of arguments.
+func parseFlags(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	n := fs.NArg()
+	if n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		return usagef("expected %s, got %d", argCount(minArgs, maxArgs), n)
+	}
+	return nil
+}
+
+func argCount(minArgs, maxArgs int) string {
+	switch {
+	case minArgs == maxArgs:
+		return fmt.Sprintf("%d arguments", minArgs)
+	case maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("ffutil "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func requireFFmpeg() error {
+	if !ffutil.FFmpegAvailable() {
+		return fmt.Errorf("ffmpeg %w", errUnavailable)
+	}
+	return nil
+}
+
+func requireFFprobe() error {
+	if !ffutil.FFprobeAvailable() {
+		return fmt.Errorf("ffprobe %w", errUnavailable)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func probeCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("probe", stderr)
+	asJSON := fs.Bool("json", false, "print JSON (an object for one file, an array for several)")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if err := requireFFprobe(); err != nil {
+		return err
+	}
+
+	var infos []*ffutil.MediaInfo
+	for _, path := range fs.Args() {
+		info, err := ffutil.Probe(path)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		if len(infos) == 1 {
+			return writeJSON(stdout, infos[0])
+		}
+		return writeJSON(stdout, infos)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		writeMediaInfo(tw, info)
+	}
+	return tw.Flush()
+}
+
+func writeMediaInfo(w io.Writer, info *ffutil.MediaInfo) {
+	fmt.Fprintf(w, "Path\t%s\n", info.Path)
+	fmt.Fprintf(w, "Format\t%s\n", info.Format)
+	fmt.Fprintf(w, "Duration\t%s\n", info.Duration.Round(time.Millisecond))
+	if info.Bitrate > 0 {
+		fmt.Fprintf(w, "Bitrate\t%d kb/s\n", info.Bitrate/1000)
+	}
+	if info.HasVideo {
+		fmt.Fprintf(w, "Video\t%s %dx%d %s fps\n", info.VideoCodec, info.Width, info.Height,
+			strconv.FormatFloat(info.FrameRate, 'f', -1, 64))
+	}
+	if info.HasAudio {
+		fmt.Fprintf(w, "Audio\t%s %d Hz %d ch\n", info.AudioCodec, info.SampleRate, info.Channels)
+	}
+	fmt.Fprintf(w, "Streams\t%d\n", len(info.Streams))
+	if len(info.Chapters) > 0 {
+		fmt.Fprintf(w, "Chapters\t%d\n", len(info.Chapters))
+	}
+}
+
+func encodersCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("encoders", stderr)
+	asJSON := fs.Bool("json", false, "print JSON")
+	hardware := fs.Bool("hardware", false, "list hardware encoders only")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := requireFFmpeg(); err != nil {
+		return err
+	}
+
+	encoders, err := ffutil.ListEncoders()
+	if err != nil {
+		return err
+	}
+	if *hardware {
+		var filtered []ffutil.Encoder
+		for _, enc := range encoders {
+			if enc.Type == "hardware" {
+				filtered = append(filtered, enc)
+			}
+		}
+		encoders = filtered
+	}
+
+	if *asJSON {
+		if encoders == nil {
+			encoders = []ffutil.Encoder{}
+		}
+		return writeJSON(stdout, encoders)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tDESCRIPTION")
+	for _, enc := range encoders {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", enc.Name, enc.Type, enc.Description)
+	}
+	return tw.Flush()
+}
+
+func bestEncoderCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("best-encoder", stderr)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	var best func() ffutil.Encoder
+	switch strings.ToLower(fs.Arg(0)) {
+	case "h264", "avc":
+		best = ffutil.BestH264Encoder
+	case "hevc", "h265":
+		best = ffutil.BestHEVCEncoder
+	default:
+		return usagef("unknown codec %q (want h264 or hevc)", fs.Arg(0))
+	}
+	if err := requireFFmpeg(); err != nil {
+		return err
+	}
+
+	enc := best()
+	if *asJSON {
+		return writeJSON(stdout, enc)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tDESCRIPTION")
+	fmt.Fprintf(tw, "%s\t%s\t%s\n", enc.Name, enc.Type, enc.Description)
+	return tw.Flush()
+}
+
+func thumbCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("thumb", stderr)
+	at := fs.Float64("t", 1, "time of the frame in seconds")
+	width := fs.Int("width", 0, "scale to this width, keeping the aspect ratio")
+	overwrite := fs.Bool("y", false, "overwrite the output file")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+	if *at < 0 || *width < 0 {
+		return usagef("-t and --width must not be negative")
+	}
+
+	cmd := ffutil.New().
+		InputWithStartTime(fs.Arg(0), *at).
+		NoAudio().
+		Overwrite(*overwrite).
+		Args("-frames:v", "1", "-q:v", "2").
+		Output(fs.Arg(1))
+	if *width > 0 {
+		cmd.VideoFilter(fmt.Sprintf("scale=%d:-2", *width))
+	}
+	if err := requireFFmpeg(); err != nil {
+		return err
+	}
+	return cmd.Run(ctx)
+}
+
+func concatCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("concat", stderr)
+	output := fs.String("o", "", "output file (required)")
+	overwrite := fs.Bool("y", false, "overwrite the output file")
+	if err := parseFlags(fs, args, 2, -1); err != nil {
+		return err
+	}
+	if *output == "" {
+		return usagef("-o is required")
+	}
+	if err := requireFFmpeg(); err != nil {
+		return err
+	}
+
+	list, err := writeConcatList(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list)
+
+	return ffutil.New().
+		InputWithOptions(list, "-f", "concat", "-safe", "0").
+		CopyVideo().
+		CopyAudio().
+		Overwrite(*overwrite).
+		Output(*output).
+		Run(ctx)
+}
+
+// writeConcatList writes a concat demuxer file list to a temporary file
+// and returns its path.
+func writeConcatList(inputs []string) (string, error) {
+	f, err := os.CreateTemp("", "ffutil-concat-*.txt")
+	if err != nil {
+		return "", err
+	}
+	for _, in := range inputs {
+		abs, err := filepath.Abs(in)
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return "", err
+		}
+		fmt.Fprintf(f, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func transcodeCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("transcode", stderr)
+	preset := fs.String("preset", "web", "preset name ("+strings.Join(ffutil.PresetNames(), ", ")+")")
+	presetsFile := fs.String("presets", "", "load additional presets from a JSON or YAML file")
+	crf := fs.Int("crf", 0, "override the preset CRF")
+	dryRun := fs.Bool("dry-run", false, "print the ffmpeg command instead of running it")
+	overwrite := fs.Bool("y", false, "overwrite the output file")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	if *presetsFile != "" {
+		if _, err := ffutil.LoadPresets(*presetsFile); err != nil {
+			return err
+		}
+	}
+	cmd, err := ffutil.New().Input(fs.Arg(0)).ApplyPreset(*preset)
+	if err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if *crf > 0 {
+		cmd.CRF(*crf)
+	}
+	cmd.Overwrite(*overwrite).Output(fs.Arg(1))
+
+	if *dryRun {
+		if err := cmd.Validate(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, cmd.String())
+		return nil
+	}
+	if err := requireFFmpeg(); err != nil {
+		return err
+	}
+	return cmd.Run(ctx)
+}
+
+func doctorCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("doctor", stderr)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	d := ffutil.Diagnose()
+	if *asJSON {
+		return writeJSON(stdout, d)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Platform\t%s/%s\n", d.OS, d.Arch)
+	fmt.Fprintf(tw, "ffmpeg\t%s\t%s\n", d.FFmpeg.Path, d.FFmpeg.Version)
+	fmt.Fprintf(tw, "ffprobe\t%s\t%s\n", d.FFprobe.Path, d.FFprobe.Version)
+	var hwEncoders []string
+	for _, enc := range d.HardwareEncoders {
+		hwEncoders = append(hwEncoders, enc.Name)
+	}
+	fmt.Fprintf(tw, "Hardware encoders\t%s\n", strings.Join(hwEncoders, " "))
+	fmt.Fprintf(tw, "Hwaccels\t%s\n", strings.Join(d.HWAccels, " "))
+	fmt.Fprintf(tw, "Devices\t%s\n", strings.Join(d.Devices, " "))
+	fmt.Fprintf(tw, "Best H.264\t%s\n", d.BestH264.Name)
+	fmt.Fprintf(tw, "Best HEVC\t%s\n", d.BestHEVC.Name)
+	for _, e := range d.Errors {
+		fmt.Fprintf(tw, "Error\t%s\n", e)
+	}
+	return tw.Flush()
+}
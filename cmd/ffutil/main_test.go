@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grokify/ffutil"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no command", nil, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"command help", []string{"probe", "-h"}, exitOK},
+		{"unknown flag", []string{"probe", "--bogus", "a.mp4"}, exitUsage},
+		{"missing file", []string{"probe"}, exitUsage},
+		{"extra argument", []string{"encoders", "extra"}, exitUsage},
+		{"unknown codec", []string{"best-encoder", "mpeg2"}, exitUsage},
+		{"thumb missing output", []string{"thumb", "in.mp4"}, exitUsage},
+		{"thumb negative time", []string{"thumb", "-t", "-1", "in.mp4", "out.jpg"}, exitUsage},
+		{"concat missing output flag", []string{"concat", "a.mp4", "b.mp4"}, exitUsage},
+		{"doctor", []string{"doctor", "--json"}, exitOK},
+		{"doctor extra argument", []string{"doctor", "extra"}, exitUsage},
+		{"transcode unknown preset", []string{"transcode", "--preset", "nope", "in.mp4", "out.mp4"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(context.Background(), tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("run(%v) = %d, want %d\nstderr: %s", tt.args, got, tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestTranscodeDryRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"transcode", "--preset", "web", "--crf", "20", "--dry-run", "in.mov", "out.mp4"}
+	if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run() = %d, want %d\nstderr: %s", code, exitOK, stderr.String())
+	}
+
+	got := stdout.String()
+	for _, want := range []string{"ffmpeg -n -i in.mov", "-c:v libx264", "-crf 20", "-movflags +faststart", "out.mp4"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("dry run output %q missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, " -y ") {
+		t.Errorf("dry run output %q should not overwrite without -y", got)
+	}
+}
+
+func TestWriteConcatList(t *testing.T) {
+	path, err := writeConcatList([]string{"/media/a.mp4", "/media/it's.mp4"})
+	if err != nil {
+		t.Fatalf("writeConcatList() error: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "file '/media/a.mp4'\nfile '/media/it'\\''s.mp4'\n"
+	if string(data) != want {
+		t.Errorf("list = %q, want %q", data, want)
+	}
+}
+
+func TestWriteMediaInfo(t *testing.T) {
+	info := &ffutil.MediaInfo{
+		Path:       "in.mp4",
+		Format:     "mov,mp4,m4a,3gp,3g2,mj2",
+		Duration:   90500 * time.Millisecond,
+		Bitrate:    2500000,
+		HasVideo:   true,
+		VideoCodec: "h264",
+		Width:      1920,
+		Height:     1080,
+		FrameRate:  29.97,
+		HasAudio:   true,
+		AudioCodec: "aac",
+		SampleRate: 48000,
+		Channels:   2,
+		Streams:    make([]ffutil.StreamInfo, 2),
+	}
+
+	var buf bytes.Buffer
+	writeMediaInfo(&buf, info)
+	got := buf.String()
+	for _, want := range []string{
+		"Duration\t1m30.5s",
+		"Bitrate\t2500 kb/s",
+		"Video\th264 1920x1080 29.97 fps",
+		"Audio\taac 48000 Hz 2 ch",
+		"Streams\t2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeMediaInfo() output missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"log/slog"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Command represents an ffmpeg command builder.
@@ -33,10 +35,44 @@ type Command struct {
 	noVideo       bool
 	overwrite     bool
 	extraArgs     []string
+	presetArgs    []string // Args of the last applied Preset
 	filterVideo   string
 	filterAudio   string
 	filterComplex string
-	metadata      map[string]string
+	metadata      []streamSetting
+	mapMetadata   string
+	mapChapters   string
+	maps          []string
+	streamMeta    []streamSetting
+	dispositions  []streamSetting
+	subtitles     []subtitleTrack
+	subtitleCodec string
+	coverArt      *coverArt
+	hwaccel       *hwPipeline
+
+	threads              int
+	filterThreads        int
+	filterComplexThreads int
+
+	logLevel    string
+	hideBanner  bool
+	stats       bool
+	logger      *slog.Logger
+	stderrLimit int
+	gracePeriod time.Duration
+
+	atomicOutput bool
+
+	softwareFallback bool
+	skipValidation   bool
+}
+
+// streamSetting is an option value, such as a metadata tag or disposition,
+// addressed by a stream specifier like "a:0" (empty for global settings).
+type streamSetting struct {
+	stream string
+	key    string
+	value  string
 }
 
 // inputSpec represents an input file with optional parameters.
@@ -47,13 +83,13 @@ type inputSpec struct {
 	loop      bool
 	duration  float64
 	startTime float64
+	options   []string
 }
 
 // New creates a new FFmpeg command builder.
 func New() *Command {
 	return &Command{
 		overwrite: true,
-		metadata:  make(map[string]string),
 	}
 }
 
@@ -85,6 +121,21 @@ func (c *Command) InputWithDuration(path string, duration float64) *Command {
 	return c
 }
 
+// InputWithStartTime adds an input that is read from the given start time.
+// Seeking on the input is faster than StartTime, which decodes and discards
+// everything before the start.
+func (c *Command) InputWithStartTime(path string, startTime float64) *Command {
+	c.inputs = append(c.inputs, inputSpec{path: path, startTime: startTime})
+	return c
+}
+
+// InputWithOptions adds an input with extra input options placed before
+// its -i, such as "-safe", "0" for the concat demuxer.
+func (c *Command) InputWithOptions(path string, options ...string) *Command {
+	c.inputs = append(c.inputs, inputSpec{path: path, options: options})
+	return c
+}
+
 // Output sets the output file path.
 func (c *Command) Output(path string) *Command {
 	c.outputPath = path
@@ -92,7 +143,12 @@ func (c *Command) Output(path string) *Command {
 }
 
 // VideoCodec sets the video codec (e.g., "libx264", "h264_videotoolbox").
+// Setting a codec other than the one chosen by HWAccel removes the
+// hardware pipeline.
 func (c *Command) VideoCodec(codec string) *Command {
+	if codec != c.videoCodec {
+		c.hwaccel = nil
+	}
 	c.videoCodec = codec
 	c.copyVideo = false
 	return c
@@ -109,6 +165,7 @@ func (c *Command) AudioCodec(codec string) *Command {
 func (c *Command) CopyVideo() *Command {
 	c.copyVideo = true
 	c.videoCodec = ""
+	c.hwaccel = nil
 	return c
 }
 
@@ -198,7 +255,8 @@ func (c *Command) StartTime(seconds float64) *Command {
 	return c
 }
 
-// Overwrite enables or disables overwriting output files.
+// Overwrite enables or disables overwriting output files. Without
+// overwrite, ffmpeg fails if the output exists (-n).
 func (c *Command) Overwrite(overwrite bool) *Command {
 	c.overwrite = overwrite
 	return c
@@ -222,9 +280,129 @@ func (c *Command) FilterComplex(filter string) *Command {
 	return c
 }
 
-// Metadata sets a metadata key-value pair.
+// Metadata sets a metadata key-value pair. Keys are emitted in the order
+// they were first set; setting a key again replaces its value.
 func (c *Command) Metadata(key, value string) *Command {
-	c.metadata[key] = value
+	for i := range c.metadata {
+		if c.metadata[i].key == key {
+			c.metadata[i].value = value
+			return c
+		}
+	}
+	c.metadata = append(c.metadata, streamSetting{key: key, value: value})
+	return c
+}
+
+// StreamMetadata sets a metadata key-value pair on the streams matching
+// the stream specifier (e.g., "a:0" for the first audio stream).
+func (c *Command) StreamMetadata(stream, key, value string) *Command {
+	c.streamMeta = append(c.streamMeta, streamSetting{stream: stream, key: key, value: value})
+	return c
+}
+
+// Disposition sets the disposition of the streams matching the stream
+// specifier (e.g., Disposition("a:1", "default")). Use "0" to clear it.
+func (c *Command) Disposition(stream, disposition string) *Command {
+	c.dispositions = append(c.dispositions, streamSetting{stream: stream, value: disposition})
+	return c
+}
+
+// BurnSubtitles renders a subtitle file (SRT, ASS, WebVTT) into the video.
+// The subtitles filter is appended to any video filter already set.
+func (c *Command) BurnSubtitles(path string) *Command {
+	filter := SubtitlesFilter(path)
+	if c.filterVideo != "" {
+		filter = c.filterVideo + "," + filter
+	}
+	c.filterVideo = filter
+	return c
+}
+
+// SubtitleTrack adds a subtitle file as a soft subtitle track with the given
+// language (ISO 639-2, e.g., "eng"; empty for none). The subtitle codec is
+// chosen from the output container and the file format unless SubtitleCodec
+// is set. Unless Map is used, the video, audio and subtitles of the first
+// input are kept. Subtitle tracks are placed before subtitle streams
+// selected from the inputs.
+func (c *Command) SubtitleTrack(path, language string) *Command {
+	c.subtitles = append(c.subtitles, subtitleTrack{
+		input:    len(c.inputs),
+		path:     path,
+		language: language,
+	})
+	c.inputs = append(c.inputs, inputSpec{path: path})
+	return c
+}
+
+// CoverArt attaches an image as cover art to an audio output (MP3, M4A,
+// FLAC). Unless Map is used, the audio of the first input is kept.
+func (c *Command) CoverArt(imagePath string) *Command {
+	c.coverArt = &coverArt{input: len(c.inputs), path: imagePath}
+	c.inputs = append(c.inputs, inputSpec{path: imagePath})
+	return c
+}
+
+// SubtitleCodec sets the subtitle codec (e.g., "mov_text", "webvtt", "copy").
+func (c *Command) SubtitleCodec(codec string) *Command {
+	c.subtitleCodec = codec
+	return c
+}
+
+// MapMetadata sets the source of the output global metadata
+// (e.g., "0" for the first input, "-1" to drop all).
+func (c *Command) MapMetadata(spec string) *Command {
+	c.mapMetadata = spec
+	return c
+}
+
+// StripMetadata removes all global and per-stream metadata copied from
+// the inputs.
+func (c *Command) StripMetadata() *Command {
+	return c.MapMetadata("-1")
+}
+
+// Map selects input streams for the output (e.g., "0:v:0", "1:a").
+// It may be called multiple times. Without Map, ffmpeg selects one
+// video and one audio stream automatically.
+func (c *Command) Map(spec string) *Command {
+	c.maps = append(c.maps, spec)
+	return c
+}
+
+// MetadataFile adds an FFMETADATA file as an input and copies its global
+// tags and chapters to the output.
+func (c *Command) MetadataFile(path string) *Command {
+	index := strconv.Itoa(len(c.inputs))
+	c.InputWithFormat(path, "ffmetadata")
+	c.mapMetadata = index
+	c.mapChapters = index
+	return c
+}
+
+// ChapterFile adds an FFMETADATA file as an input and copies only its
+// chapters to the output. See WriteChapterFile.
+func (c *Command) ChapterFile(path string) *Command {
+	index := strconv.Itoa(len(c.inputs))
+	c.InputWithFormat(path, "ffmetadata")
+	c.mapChapters = index
+	return c
+}
+
+// Threads sets the number of encoder threads (-threads).
+func (c *Command) Threads(n int) *Command {
+	c.threads = n
+	return c
+}
+
+// FilterThreads sets the number of threads for -vf and -af filter graphs.
+func (c *Command) FilterThreads(n int) *Command {
+	c.filterThreads = n
+	return c
+}
+
+// FilterComplexThreads sets the number of threads for the -filter_complex graph.
+func (c *Command) FilterComplexThreads(n int) *Command {
+	c.filterComplexThreads = n
 	return c
 }
 
@@ -238,13 +416,34 @@ func (c *Command) Args(args ...string) *Command {
 func (c *Command) Build() []string {
 	var args []string
 
-	// Global options
+	// Global options. Without -y, -n makes ffmpeg fail on an existing
+	// output instead of prompting on stdin.
 	if c.overwrite {
 		args = append(args, "-y")
+	} else {
+		args = append(args, "-n")
+	}
+	if c.hideBanner {
+		args = append(args, "-hide_banner")
+	}
+	if level := c.logLevelArg(); level != "" {
+		args = append(args, "-loglevel", level)
+	}
+	if c.stats {
+		args = append(args, "-stats")
+	}
+	if c.filterThreads > 0 {
+		args = append(args, "-filter_threads", strconv.Itoa(c.filterThreads))
+	}
+	if c.filterComplexThreads > 0 {
+		args = append(args, "-filter_complex_threads", strconv.Itoa(c.filterComplexThreads))
+	}
+	if c.hwaccel != nil {
+		args = append(args, c.hwGlobalArgs()...)
 	}
 
 	// Input options
-	for _, input := range c.inputs {
+	for i, input := range c.inputs {
 		if input.loop {
 			args = append(args, "-loop", "1")
 		}
@@ -260,6 +459,10 @@ func (c *Command) Build() []string {
 		if input.startTime > 0 {
 			args = append(args, "-ss", formatDuration(input.startTime))
 		}
+		args = append(args, input.options...)
+		if i == 0 && c.hwaccel != nil {
+			args = append(args, c.hwInputArgs()...)
+		}
 		args = append(args, "-i", input.path)
 	}
 
@@ -267,13 +470,23 @@ func (c *Command) Build() []string {
 	if c.filterComplex != "" {
 		args = append(args, "-filter_complex", c.filterComplex)
 	}
-	if c.filterVideo != "" {
+	if c.hwaccel != nil {
+		if vf := c.hwVideoFilter(); vf != "" {
+			args = append(args, "-vf", vf)
+		}
+	} else if c.filterVideo != "" {
 		args = append(args, "-vf", c.filterVideo)
 	}
 	if c.filterAudio != "" {
 		args = append(args, "-af", c.filterAudio)
 	}
 
+	// Stream selection
+	maps, sourceSubtitles := c.streamMaps()
+	for _, m := range maps {
+		args = append(args, "-map", m)
+	}
+
 	// Video options
 	if c.noVideo {
 		args = append(args, "-vn")
@@ -281,9 +494,11 @@ func (c *Command) Build() []string {
 		args = append(args, "-c:v", "copy")
 	} else if c.videoCodec != "" {
 		args = append(args, "-c:v", c.videoCodec)
+	} else if c.coverArt != nil {
+		args = append(args, "-c:v", c.coverArt.codec())
 	}
 
-	if c.width > 0 && c.height > 0 {
+	if c.width > 0 && c.height > 0 && c.hwaccel == nil {
 		args = append(args, "-s", fmt.Sprintf("%dx%d", c.width, c.height))
 	}
 
@@ -291,15 +506,13 @@ func (c *Command) Build() []string {
 		args = append(args, "-r", strconv.Itoa(c.fps))
 	}
 
-	if c.crf > 0 {
-		args = append(args, "-crf", strconv.Itoa(c.crf))
-	}
+	args = append(args, c.qualityArgs()...)
 
 	if c.preset != "" {
 		args = append(args, "-preset", c.preset)
 	}
 
-	if c.pixelFormat != "" {
+	if c.pixelFormat != "" && c.hwaccel == nil {
 		args = append(args, "-pix_fmt", c.pixelFormat)
 	}
 
@@ -328,7 +541,33 @@ func (c *Command) Build() []string {
 		args = append(args, "-ac", strconv.Itoa(c.channels))
 	}
 
+	// Subtitle options. Subtitle tracks are the first output subtitle
+	// streams (see streamMaps), so track i is output stream s:i.
+	if c.subtitleCodec != "" {
+		args = append(args, "-c:s", c.subtitleCodec)
+	} else if len(c.subtitles) > 0 {
+		if sourceSubtitles {
+			if codec := sourceSubtitleCodec(c.outputPath); codec != "" {
+				args = append(args, "-c:s", codec)
+			}
+		}
+		for i, sub := range c.subtitles {
+			if codec := subtitleCodecFor(c.outputPath, sub.path); codec != "" {
+				args = append(args, fmt.Sprintf("-c:s:%d", i), codec)
+			}
+		}
+	}
+	for i, sub := range c.subtitles {
+		if sub.language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:s:%d", i), "language="+sub.language)
+		}
+	}
+
 	// Output options
+	if c.threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(c.threads))
+	}
+
 	if c.duration > 0 {
 		args = append(args, "-t", formatDuration(c.duration))
 	}
@@ -338,11 +577,28 @@ func (c *Command) Build() []string {
 	}
 
 	// Metadata
-	for key, value := range c.metadata {
-		args = append(args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+	if c.mapMetadata != "" {
+		args = append(args, "-map_metadata", c.mapMetadata)
+	}
+	if c.mapChapters != "" {
+		args = append(args, "-map_chapters", c.mapChapters)
+	}
+	for _, m := range c.metadata {
+		args = append(args, "-metadata", fmt.Sprintf("%s=%s", m.key, m.value))
+	}
+
+	for _, m := range c.streamMeta {
+		args = append(args, "-metadata:s:"+m.stream, fmt.Sprintf("%s=%s", m.key, m.value))
+	}
+	for _, d := range c.dispositions {
+		args = append(args, "-disposition:"+d.stream, d.value)
+	}
+	if c.coverArt != nil {
+		args = append(args, c.coverArt.args(c.outputPath)...)
 	}
 
 	// Extra arguments
+	args = append(args, c.presetArgs...)
 	args = append(args, c.extraArgs...)
 
 	// Output path
@@ -367,28 +623,85 @@ func (c *Command) String() string {
 	return "ffmpeg " + strings.Join(quoted, " ")
 }
 
-// Run executes the ffmpeg command.
+// Run validates and executes the ffmpeg command.
+// Use SkipValidation to run without validating.
 func (c *Command) Run(ctx context.Context) error {
-	args := c.Build()
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	_, err := c.run(ctx, nil)
+	return err
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w\nstderr: %s", err, stderr.String())
+// run validates and executes the command, reporting progress to fn if it
+// is not nil. With SoftwareFallback, a hardware encoder initialization
+// failure is retried with the software equivalent encoder.
+func (c *Command) run(ctx context.Context, fn func(Progress)) (*Result, error) {
+	if err := c.validateForRun(); err != nil {
+		return nil, err
 	}
-	return nil
+	if err := c.checkOutput(); err != nil {
+		return nil, err
+	}
+	outputExisted := c.softwareFallback && fileExists(c.outputPath)
+
+	result, err := c.exec(ctx, fn)
+	if err == nil || !c.softwareFallback || !isEncoderInitError(err) {
+		return result, err
+	}
+	fallback := c.softwareFallbackCommand()
+	if fallback == nil {
+		return result, err
+	}
+	if !outputExisted {
+		os.Remove(c.outputPath) // partial output of the failed attempt
+	}
+
+	result, fallbackErr := fallback.exec(ctx, fn)
+	result.Fallback = true
+	result.FallbackCause = err
+	return result, fallbackErr
 }
 
-// RunWithOutput executes the ffmpeg command and returns combined output.
+// exec executes the command once without validating it and returns the
+// statistics of the ffmpeg process. Progress is read from "-progress"
+// output unless the command writes to stdout.
+func (c *Command) exec(ctx context.Context, fn func(Progress)) (*Result, error) {
+	p, err := c.start(ctx, fn, c.gracePeriod, nil)
+	if err != nil {
+		return newResult(c, nil, 0, Progress{}), fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return p.Wait()
+}
+
+// RunWithOutput validates and executes the ffmpeg command and returns its
+// stderr, combined with stdout when the output is stdout ("-"). It runs
+// like Run without SoftwareFallback: AtomicOutput is honored, log lines
+// are streamed to the Logger, the error holds at most StderrLimit bytes of
+// stderr, and ffmpeg decodes on the CPU when the installed ffmpeg does not
+// support the HWAccel method. The returned output is not limited.
 func (c *Command) RunWithOutput(ctx context.Context) ([]byte, error) {
-	args := c.Build()
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
+	if err := c.validateForRun(); err != nil {
+		return nil, err
+	}
+	if err := c.checkOutput(); err != nil {
+		return nil, err
+	}
+	var output bytes.Buffer
+	p, err := c.start(ctx, nil, c.gracePeriod, &output)
 	if err != nil {
-		return output, fmt.Errorf("ffmpeg failed: %w\noutput: %s", err, string(output))
+		return nil, fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	_, err = p.Wait()
+	return output.Bytes(), err
+}
+
+// validateForRun validates the command unless validation was skipped.
+func (c *Command) validateForRun() error {
+	if c.skipValidation {
+		return nil
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid ffmpeg command: %w", err)
 	}
-	return output, nil
+	return nil
 }
 
 // formatDuration formats a duration in seconds for ffmpeg.
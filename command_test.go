@@ -1,6 +1,7 @@
 package ffutil
 
 import (
+	"log/slog"
 	"strings"
 	"testing"
 )
@@ -160,6 +161,73 @@ func TestCommandBuild(t *testing.T) {
 				Output("output.mp4"),
 			contains: []string{"-metadata", "title=My Video"},
 		},
+		{
+			name: "with chapter file",
+			cmd: New().
+				Input("input.mp4").
+				ChapterFile("chapters.txt").
+				CopyVideo().
+				Output("output.mp4"),
+			contains:    []string{"-f ffmetadata -i chapters.txt", "-map_chapters 1"},
+			notContains: []string{"-map_metadata"},
+		},
+		{
+			name: "with metadata file",
+			cmd: New().
+				Input("input.mp4").
+				MetadataFile("meta.txt").
+				Output("output.mp4"),
+			contains: []string{"-map_metadata 1", "-map_chapters 1"},
+		},
+		{
+			name: "with stream metadata and disposition",
+			cmd: New().
+				Input("input.mkv").
+				Map("0").
+				StreamMetadata("a:0", "language", "eng").
+				Disposition("a:1", "default").
+				StripMetadata().
+				Output("output.mkv"),
+			contains: []string{
+				"-map 0",
+				"-metadata:s:a:0 language=eng",
+				"-disposition:a:1 default",
+				"-map_metadata -1",
+			},
+		},
+		{
+			name: "with threads",
+			cmd: New().
+				Input("input.mp4").
+				VideoFilter("scale=1280:-2").
+				VideoCodec("libx264").
+				Threads(4).
+				FilterThreads(2).
+				FilterComplexThreads(3).
+				Output("output.mp4"),
+			contains: []string{
+				"-y -filter_threads 2 -filter_complex_threads 3 -i input.mp4",
+				"-threads 4 output.mp4",
+			},
+		},
+		{
+			name: "with log options",
+			cmd: New().
+				Input("input.mp4").
+				HideBanner().
+				LogLevel("warning").
+				Stats().
+				Output("output.mp4"),
+			contains: []string{"-y -hide_banner -loglevel warning -stats -i input.mp4"},
+		},
+		{
+			name: "logger adds level prefix",
+			cmd: New().
+				Input("input.mp4").
+				Logger(slog.New(slog.DiscardHandler)).
+				Output("output.mp4"),
+			contains: []string{"-loglevel level+info -i input.mp4"},
+		},
 		{
 			name: "image input with loop",
 			cmd: New().
@@ -173,6 +241,21 @@ func TestCommandBuild(t *testing.T) {
 				"-i", "image.png",
 			},
 		},
+		{
+			name: "input with start time",
+			cmd: New().
+				InputWithStartTime("input.mp4", 90).
+				Output("output.mp4"),
+			contains: []string{"-ss 90.000 -i input.mp4"},
+		},
+		{
+			name: "input with options",
+			cmd: New().
+				InputWithOptions("list.txt", "-f", "concat", "-safe", "0").
+				CopyVideo().
+				Output("output.mp4"),
+			contains: []string{"-f concat -safe 0 -i list.txt"},
+		},
 		{
 			name: "input with format",
 			cmd: New().
@@ -194,6 +277,7 @@ func TestCommandBuild(t *testing.T) {
 				Input("input.mp4").
 				Overwrite(false).
 				Output("output.mp4"),
+			contains:    []string{"-n -i input.mp4"},
 			notContains: []string{"-y"},
 		},
 	}
@@ -0,0 +1,90 @@
+package ffutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoCoverArt is returned when a media file has no embedded cover art.
+var ErrNoCoverArt = errors.New("no cover art found")
+
+// coverArt is an image attached to a command output as cover art.
+type coverArt struct {
+	input int
+	path  string
+}
+
+// codec returns the video codec for the cover image. JPEG and PNG images
+// are copied as-is; other formats are converted to JPEG.
+func (a *coverArt) codec() string {
+	switch strings.ToLower(filepath.Ext(a.path)) {
+	case ".jpg", ".jpeg", ".png":
+		return "copy"
+	}
+	return "mjpeg"
+}
+
+// args returns the output arguments that mark the image as cover art for
+// the container of output.
+func (a *coverArt) args(output string) []string {
+	args := []string{"-disposition:v:0", "attached_pic"}
+	if strings.ToLower(filepath.Ext(output)) == ".mp3" {
+		// ID3v2.3 has the widest player support for embedded pictures.
+		args = append(args,
+			"-id3v2_version", "3",
+			"-metadata:s:v", "title=Album cover",
+			"-metadata:s:v", "comment=Cover (front)",
+		)
+	}
+	return args
+}
+
+// CoverArt returns the first stream with the attached_pic disposition,
+// or nil if the file has no cover art.
+func (m *MediaInfo) CoverArt() *StreamInfo {
+	for i := range m.Streams {
+		if m.Streams[i].HasDisposition("attached_pic") {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// ExtractCoverArt writes the embedded cover art of an audio file (MP3, M4A,
+// FLAC) to output without re-encoding. The output extension should match
+// the image codec (.jpg for mjpeg, .png for png); see CoverArtCodec.
+// It returns ErrNoCoverArt if the file has none.
+func ExtractCoverArt(ctx context.Context, input, output string) error {
+	info, err := Probe(input)
+	if err != nil {
+		return err
+	}
+	pic := info.CoverArt()
+	if pic == nil {
+		return fmt.Errorf("%w in %s", ErrNoCoverArt, input)
+	}
+	return New().
+		Input(input).
+		Map(fmt.Sprintf("0:%d", pic.Index)).
+		CopyVideo().
+		Args("-frames:v", "1").
+		Output(output).
+		Run(ctx)
+}
+
+// CoverArtCodec returns the codec of the embedded cover art (e.g., "mjpeg",
+// "png"). It returns ErrNoCoverArt if the file has none.
+func CoverArtCodec(path string) (string, error) {
+	info, err := Probe(path)
+	if err != nil {
+		return "", err
+	}
+	pic := info.CoverArt()
+	if pic == nil {
+		return "", fmt.Errorf("%w in %s", ErrNoCoverArt, path)
+	}
+	return pic.Codec, nil
+}
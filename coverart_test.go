@@ -0,0 +1,83 @@
+package ffutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoverArtCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmd         *Command
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "mp3 with jpeg",
+			cmd: New().
+				Input("audio.wav").
+				CoverArt("cover.jpg").
+				AudioCodec("libmp3lame").
+				Output("song.mp3"),
+			contains: []string{
+				"-i audio.wav -i cover.jpg",
+				"-map 0:a -map 1:v",
+				"-c:v copy",
+				"-disposition:v:0 attached_pic",
+				"-id3v2_version 3",
+			},
+		},
+		{
+			name: "m4a with webp",
+			cmd: New().
+				Input("audio.wav").
+				CoverArt("cover.webp").
+				AudioCodec("aac").
+				Output("song.m4a"),
+			contains:    []string{"-c:v mjpeg", "-disposition:v:0 attached_pic"},
+			notContains: []string{"-id3v2_version"},
+		},
+		{
+			name: "explicit map",
+			cmd: New().
+				Input("audio.flac").
+				Map("0:a:0").
+				CoverArt("cover.png").
+				CopyAudio().
+				Output("song.flac"),
+			contains: []string{"-map 0:a:0 -map 1:v", "-c:v copy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := strings.Join(tt.cmd.Build(), " ")
+			for _, want := range tt.contains {
+				if !strings.Contains(args, want) {
+					t.Errorf("Build() missing %q in %s", want, args)
+				}
+			}
+			for _, notWant := range tt.notContains {
+				if strings.Contains(args, notWant) {
+					t.Errorf("Build() should not contain %q in %s", notWant, args)
+				}
+			}
+		})
+	}
+}
+
+func TestMediaInfoCoverArt(t *testing.T) {
+	info := &MediaInfo{Streams: []StreamInfo{
+		{Index: 0, Type: "audio", Codec: "mp3"},
+		{Index: 1, Type: "video", Codec: "mjpeg", Disposition: []string{"attached_pic"}},
+	}}
+
+	pic := info.CoverArt()
+	if pic == nil || pic.Index != 1 {
+		t.Fatalf("CoverArt() = %v, want stream 1", pic)
+	}
+
+	if (&MediaInfo{}).CoverArt() != nil {
+		t.Error("CoverArt() should be nil without attached pictures")
+	}
+}
@@ -0,0 +1,346 @@
+package ffutil
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval represents a detected span of media, such as a silent or black section.
+type Interval struct {
+	Start    time.Duration `json:"start"`
+	End      time.Duration `json:"end"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SilenceOptions configures silence detection.
+type SilenceOptions struct {
+	// NoiseDB is the noise tolerance in dB (default -60).
+	NoiseDB float64
+
+	// MinDuration is the minimum silence length in seconds (default 2).
+	MinDuration float64
+}
+
+// BlackOptions configures black frame detection.
+type BlackOptions struct {
+	// MinDuration is the minimum black section length in seconds (default 2).
+	MinDuration float64
+
+	// PictureThreshold is the ratio of black pixels needed to consider
+	// a picture black, from 0 to 1 (default 0.98).
+	PictureThreshold float64
+
+	// PixelThreshold is the luminance at or below which a pixel is
+	// considered black, from 0 to 1 (default 0.10).
+	PixelThreshold float64
+}
+
+// FreezeOptions configures frozen frame detection.
+type FreezeOptions struct {
+	// NoiseDB is the noise tolerance in dB (default -60).
+	NoiseDB float64
+
+	// MinDuration is the minimum freeze length in seconds (default 2).
+	MinDuration float64
+}
+
+// DetectSilence runs the silencedetect filter and returns the silent intervals.
+func DetectSilence(ctx context.Context, path string, opts SilenceOptions) ([]Interval, error) {
+	output, err := New().
+		Input(path).
+		AudioFilter(silenceFilter(opts)).
+		NoVideo().
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return closeIntervals(path, parseSilenceLog(string(output)))
+}
+
+// DetectBlack runs the blackdetect filter and returns the black intervals.
+func DetectBlack(ctx context.Context, path string, opts BlackOptions) ([]Interval, error) {
+	output, err := New().
+		Input(path).
+		VideoFilter(blackFilter(opts)).
+		NoAudio().
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return closeIntervals(path, parseBlackLog(string(output)))
+}
+
+// DetectFreeze runs the freezedetect filter and returns the frozen intervals.
+func DetectFreeze(ctx context.Context, path string, opts FreezeOptions) ([]Interval, error) {
+	output, err := New().
+		Input(path).
+		VideoFilter(freezeFilter(opts)).
+		NoAudio().
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return closeIntervals(path, parseFreezeLog(string(output)))
+}
+
+// TrimRange is a span of content in seconds, suitable for
+// Command.StartTime and Command.Duration.
+type TrimRange struct {
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+}
+
+// Apply sets the start time and duration of the command to the range.
+func (r TrimRange) Apply(c *Command) *Command {
+	return c.StartTime(r.Start).Duration(r.Duration)
+}
+
+// trimTolerance is how close an interval must be to the start or end of
+// the media to be treated as leading or trailing dead air.
+const trimTolerance = 100 * time.Millisecond
+
+// ContentRange returns the range of media that remains after removing
+// leading and trailing dead intervals, such as silence or black frames.
+// Intervals from several detectors may be passed together.
+// It returns false if no content remains.
+func ContentRange(total time.Duration, intervals ...[]Interval) (TrimRange, bool) {
+	merged := mergeIntervals(intervals...)
+
+	start, end := time.Duration(0), total
+	for _, iv := range merged {
+		if iv.Start <= start+trimTolerance && iv.End > start {
+			start = iv.End
+		}
+	}
+	for i := len(merged) - 1; i >= 0; i-- {
+		iv := merged[i]
+		if iv.End >= end-trimTolerance && iv.Start < end {
+			end = iv.Start
+		}
+	}
+
+	if end <= start {
+		return TrimRange{}, false
+	}
+	return TrimRange{
+		Start:    start.Seconds(),
+		Duration: (end - start).Seconds(),
+	}, true
+}
+
+// mergeIntervals combines interval lists, sorting them and joining overlaps.
+func mergeIntervals(lists ...[]Interval) []Interval {
+	var all []Interval
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Start < all[j].Start })
+
+	var merged []Interval
+	for _, iv := range all {
+		n := len(merged)
+		if n > 0 && iv.Start <= merged[n-1].End {
+			if iv.End > merged[n-1].End {
+				merged[n-1].End = iv.End
+				merged[n-1].Duration = merged[n-1].End - merged[n-1].Start
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+func silenceFilter(opts SilenceOptions) string {
+	noise := opts.NoiseDB
+	if noise == 0 {
+		noise = -60
+	}
+	d := opts.MinDuration
+	if d <= 0 {
+		d = 2
+	}
+	return fmt.Sprintf("silencedetect=noise=%sdB:d=%s", formatFloat(noise), formatFloat(d))
+}
+
+func blackFilter(opts BlackOptions) string {
+	d := opts.MinDuration
+	if d <= 0 {
+		d = 2
+	}
+	picTh := opts.PictureThreshold
+	if picTh <= 0 {
+		picTh = 0.98
+	}
+	pixTh := opts.PixelThreshold
+	if pixTh <= 0 {
+		pixTh = 0.10
+	}
+	return fmt.Sprintf("blackdetect=d=%s:pic_th=%s:pix_th=%s",
+		formatFloat(d), formatFloat(picTh), formatFloat(pixTh))
+}
+
+func freezeFilter(opts FreezeOptions) string {
+	noise := opts.NoiseDB
+	if noise == 0 {
+		noise = -60
+	}
+	d := opts.MinDuration
+	if d <= 0 {
+		d = 2
+	}
+	return fmt.Sprintf("freezedetect=n=%sdB:d=%s", formatFloat(noise), formatFloat(d))
+}
+
+// openEnd marks an interval whose end was not reported before the log ended.
+const openEnd = time.Duration(-1)
+
+// parseSilenceLog extracts intervals from silencedetect log lines:
+//
+//	[silencedetect @ 0x...] silence_start: 1.5
+//	[silencedetect @ 0x...] silence_end: 3.5 | silence_duration: 2
+func parseSilenceLog(log string) []Interval {
+	var intervals []Interval
+	var open *Interval
+	for _, line := range logLines(log) {
+		if !strings.Contains(line, "[silencedetect") {
+			continue
+		}
+		fields := logFields(line)
+		if v, ok := fields["silence_start"]; ok {
+			open = &Interval{Start: v, End: openEnd}
+		}
+		if v, ok := fields["silence_end"]; ok && open != nil {
+			open.End = v
+			open.Duration = v - open.Start
+			intervals = append(intervals, *open)
+			open = nil
+		}
+	}
+	if open != nil {
+		intervals = append(intervals, *open)
+	}
+	return intervals
+}
+
+// parseBlackLog extracts intervals from blackdetect log lines:
+//
+//	[blackdetect @ 0x...] black_start:0 black_end:2.5 black_duration:2.5
+func parseBlackLog(log string) []Interval {
+	var intervals []Interval
+	for _, line := range logLines(log) {
+		if !strings.Contains(line, "[blackdetect") {
+			continue
+		}
+		fields := logFields(line)
+		start, ok1 := fields["black_start"]
+		end, ok2 := fields["black_end"]
+		if !ok1 || !ok2 {
+			continue
+		}
+		intervals = append(intervals, Interval{Start: start, End: end, Duration: end - start})
+	}
+	return intervals
+}
+
+// parseFreezeLog extracts intervals from freezedetect log lines:
+//
+//	[freezedetect @ 0x...] lavfi.freezedetect.freeze_start: 2
+//	[freezedetect @ 0x...] lavfi.freezedetect.freeze_duration: 3
+//	[freezedetect @ 0x...] lavfi.freezedetect.freeze_end: 5
+func parseFreezeLog(log string) []Interval {
+	var intervals []Interval
+	var open *Interval
+	for _, line := range logLines(log) {
+		if !strings.Contains(line, "[freezedetect") {
+			continue
+		}
+		fields := logFields(strings.ReplaceAll(line, "lavfi.freezedetect.", ""))
+		if v, ok := fields["freeze_start"]; ok {
+			open = &Interval{Start: v, End: openEnd}
+		}
+		if v, ok := fields["freeze_end"]; ok && open != nil {
+			open.End = v
+			open.Duration = v - open.Start
+			intervals = append(intervals, *open)
+			open = nil
+		}
+	}
+	if open != nil {
+		intervals = append(intervals, *open)
+	}
+	return intervals
+}
+
+// closeIntervals sets the end of any interval still open at the end of
+// the log to the media duration.
+func closeIntervals(path string, intervals []Interval) ([]Interval, error) {
+	for i := range intervals {
+		if intervals[i].End != openEnd {
+			continue
+		}
+		total, err := Duration(path)
+		if err != nil {
+			return nil, err
+		}
+		intervals[i].End = total
+		intervals[i].Duration = total - intervals[i].Start
+	}
+	return intervals, nil
+}
+
+// logLines splits ffmpeg log output into lines, treating carriage returns
+// from progress output as line breaks.
+func logLines(log string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(log, "\r", "\n")))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// logFields parses "key: value" and "key:value" pairs of time values in
+// seconds from a filter log line. Pairs may be separated by spaces or "|".
+func logFields(line string) map[string]time.Duration {
+	if i := strings.Index(line, "]"); i >= 0 {
+		line = line[i+1:]
+	}
+	line = strings.ReplaceAll(line, "|", " ")
+	line = strings.ReplaceAll(line, ": ", ":")
+
+	fields := make(map[string]time.Duration)
+	for _, tok := range strings.Fields(line) {
+		key, value, ok := strings.Cut(tok, ":")
+		if !ok {
+			continue
+		}
+		if secs, err := strconv.ParseFloat(value, 64); err == nil {
+			fields[key] = secondsToDuration(secs)
+		}
+	}
+	return fields
+}
+
+// secondsToDuration converts fractional seconds to a time.Duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
+
+// formatFloat formats a float without trailing zeros for use in filter arguments.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,122 @@
+package ffutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSilenceLog(t *testing.T) {
+	log := `Input #0, wav, from 'in.wav':
+[silencedetect @ 0x7f8] silence_start: 0
+[silencedetect @ 0x7f8] silence_end: 1.5 | silence_duration: 1.5
+size=N/A time=00:00:05.00 bitrate=N/A speed= 100x` + "\r" + `
+[silencedetect @ 0x7f8] silence_start: 8.25
+[silencedetect @ 0x7f8] silence_end: 10 | silence_duration: 1.75
+[silencedetect @ 0x7f8] silence_start: 12.5
+`
+	got := parseSilenceLog(log)
+	if len(got) != 3 {
+		t.Fatalf("parseSilenceLog() returned %d intervals, want 3: %v", len(got), got)
+	}
+
+	want := Interval{Start: 8250 * time.Millisecond, End: 10 * time.Second, Duration: 1750 * time.Millisecond}
+	if got[1] != want {
+		t.Errorf("parseSilenceLog()[1] = %v, want %v", got[1], want)
+	}
+
+	if got[2].End != openEnd {
+		t.Errorf("parseSilenceLog()[2].End = %v, want open interval", got[2].End)
+	}
+}
+
+func TestParseBlackLog(t *testing.T) {
+	log := `[blackdetect @ 0x600] black_start:0 black_end:2.5 black_duration:2.5
+[blackdetect @ 0x600] black_start:58.04 black_end:60 black_duration:1.96
+`
+	got := parseBlackLog(log)
+	if len(got) != 2 {
+		t.Fatalf("parseBlackLog() returned %d intervals, want 2", len(got))
+	}
+
+	if got[0].End != 2500*time.Millisecond {
+		t.Errorf("parseBlackLog()[0].End = %v, want 2.5s", got[0].End)
+	}
+
+	if got[1].Start != 58040*time.Millisecond {
+		t.Errorf("parseBlackLog()[1].Start = %v, want 58.04s", got[1].Start)
+	}
+}
+
+func TestParseFreezeLog(t *testing.T) {
+	log := `[freezedetect @ 0x5a0] lavfi.freezedetect.freeze_start: 2.002
+[freezedetect @ 0x5a0] lavfi.freezedetect.freeze_duration: 3.003
+[freezedetect @ 0x5a0] lavfi.freezedetect.freeze_end: 5.005
+`
+	got := parseFreezeLog(log)
+	if len(got) != 1 {
+		t.Fatalf("parseFreezeLog() returned %d intervals, want 1", len(got))
+	}
+
+	if got[0].Start != 2002*time.Millisecond || got[0].End != 5005*time.Millisecond {
+		t.Errorf("parseFreezeLog()[0] = %v, want 2.002s-5.005s", got[0])
+	}
+}
+
+func TestDetectFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"silence defaults", silenceFilter(SilenceOptions{}), "silencedetect=noise=-60dB:d=2"},
+		{"silence custom", silenceFilter(SilenceOptions{NoiseDB: -35, MinDuration: 0.5}), "silencedetect=noise=-35dB:d=0.5"},
+		{"black defaults", blackFilter(BlackOptions{}), "blackdetect=d=2:pic_th=0.98:pix_th=0.1"},
+		{"freeze custom", freezeFilter(FreezeOptions{NoiseDB: -50, MinDuration: 1}), "freezedetect=n=-50dB:d=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("filter = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	total := 60 * time.Second
+	silence := []Interval{
+		{Start: 0, End: 2 * time.Second},
+		{Start: 30 * time.Second, End: 31 * time.Second},
+		{Start: 57 * time.Second, End: 60 * time.Second},
+	}
+	black := []Interval{
+		{Start: 1 * time.Second, End: 3 * time.Second},
+	}
+
+	r, ok := ContentRange(total, silence, black)
+	if !ok {
+		t.Fatal("ContentRange() reported no content")
+	}
+
+	if r.Start != 3 {
+		t.Errorf("ContentRange().Start = %v, want 3", r.Start)
+	}
+
+	if r.Duration != 54 {
+		t.Errorf("ContentRange().Duration = %v, want 54", r.Duration)
+	}
+
+	args := strings.Join(r.Apply(New().Input("in.mp4").Output("out.mp4")).Build(), " ")
+	if !strings.Contains(args, "-ss 3.000") || !strings.Contains(args, "-t 54.000") {
+		t.Errorf("TrimRange.Apply() args = %s", args)
+	}
+}
+
+func TestContentRangeAllDead(t *testing.T) {
+	_, ok := ContentRange(10*time.Second, []Interval{{Start: 0, End: 10 * time.Second}})
+	if ok {
+		t.Error("ContentRange() should report no content when fully covered")
+	}
+}
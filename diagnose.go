@@ -0,0 +1,182 @@
+package ffutil
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Diagnosis is a snapshot of the ffmpeg environment for debugging encoding
+// problems. It is JSON-serializable for attaching to bug reports.
+type Diagnosis struct {
+	// OS and Arch are the runtime platform (e.g., "linux", "amd64")
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+
+	// FFmpeg and FFprobe describe the installed binaries
+	FFmpeg  ToolInfo `json:"ffmpeg"`
+	FFprobe ToolInfo `json:"ffprobe"`
+
+	// Compiler is the compiler ffmpeg was built with
+	Compiler string `json:"compiler,omitempty"`
+
+	// Configuration lists the ffmpeg build configure flags
+	// (e.g., "--enable-libx264")
+	Configuration []string `json:"configuration,omitempty"`
+
+	// Libraries maps FFmpeg library names to their runtime versions
+	// (e.g., "libavcodec": "60.3.100")
+	Libraries map[string]string `json:"libraries,omitempty"`
+
+	// HardwareEncoders lists the hardware video encoders ffmpeg supports
+	HardwareEncoders []Encoder `json:"hardwareEncoders,omitempty"`
+
+	// HWAccels lists the hardware decoding methods (see HWAccels)
+	HWAccels []string `json:"hwaccels,omitempty"`
+
+	// Devices lists the GPU device nodes present (e.g., "/dev/dri/renderD128")
+	Devices []string `json:"devices,omitempty"`
+
+	// HardwareEncoderAvailable is the result of HardwareEncoderAvailable
+	HardwareEncoderAvailable bool `json:"hardwareEncoderAvailable"`
+
+	// BestH264 and BestHEVC are the encoders chosen by BestH264Encoder
+	// and BestHEVCEncoder
+	BestH264 Encoder `json:"bestH264"`
+	BestHEVC Encoder `json:"bestHEVC"`
+
+	// Errors lists the checks that failed
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ToolInfo describes an installed ffmpeg tool.
+type ToolInfo struct {
+	// Path is the resolved executable path (empty if not found)
+	Path string `json:"path,omitempty"`
+
+	// Version is the first line of "-version" output
+	Version string `json:"version,omitempty"`
+}
+
+// deviceGlobs are the device node patterns of GPUs used by hardware
+// encoders and decoders.
+var deviceGlobs = []string{
+	"/dev/dri/renderD*",
+	"/dev/dri/card*",
+	"/dev/nvidia*",
+}
+
+// Diagnose collects a report of the ffmpeg environment. Checks that fail
+// are recorded in Diagnosis.Errors rather than stopping the report.
+func Diagnose() *Diagnosis {
+	d := &Diagnosis{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+	addErr := func(format string, args ...any) {
+		d.Errors = append(d.Errors, fmt.Sprintf(format, args...))
+	}
+
+	var err error
+	if d.FFmpeg.Path, err = exec.LookPath("ffmpeg"); err != nil {
+		addErr("ffmpeg not found: %v", err)
+	}
+	if d.FFprobe.Path, err = exec.LookPath("ffprobe"); err != nil {
+		addErr("ffprobe not found: %v", err)
+	}
+
+	if d.FFprobe.Path != "" {
+		if d.FFprobe.Version, err = ProbeVersion(); err != nil {
+			addErr("ffprobe -version failed: %v", err)
+		}
+	}
+	if d.FFmpeg.Path != "" {
+		d.diagnoseFFmpeg(addErr)
+	}
+
+	for _, pattern := range deviceGlobs {
+		matches, _ := filepath.Glob(pattern)
+		d.Devices = append(d.Devices, matches...)
+	}
+	return d
+}
+
+func (d *Diagnosis) diagnoseFFmpeg(addErr func(string, ...any)) {
+	if output, err := exec.Command("ffmpeg", "-version").Output(); err != nil {
+		addErr("ffmpeg -version failed: %v", err)
+	} else {
+		d.FFmpeg.Version, d.Compiler, d.Configuration, d.Libraries = parseVersionOutput(string(output))
+	}
+
+	if encoders, err := ListEncoders(); err != nil {
+		addErr("ffmpeg -encoders failed: %v", err)
+	} else {
+		for _, enc := range encoders {
+			if enc.Type == "hardware" {
+				d.HardwareEncoders = append(d.HardwareEncoders, enc)
+			}
+		}
+	}
+
+	if methods, err := listHWAccels(); err != nil {
+		addErr("ffmpeg -hwaccels failed: %v", err)
+	} else {
+		d.HWAccels = methods
+	}
+
+	d.HardwareEncoderAvailable = HardwareEncoderAvailable()
+	d.BestH264 = BestH264Encoder()
+	d.BestHEVC = BestHEVCEncoder()
+}
+
+// parseVersionOutput parses "ffmpeg -version" output into the version line,
+// compiler, configure flags and library versions.
+func parseVersionOutput(output string) (version, compiler string, config []string, libs map[string]string) {
+	for i, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			version = line
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "built with "); ok {
+			compiler = rest
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "configuration:"); ok {
+			config = strings.Fields(rest)
+			continue
+		}
+
+		// Library lines look like "libavcodec     60.  3.100 / 60.  3.100",
+		// giving the build-time and runtime versions.
+		name, rest, ok := strings.Cut(line, " ")
+		if !ok || !strings.HasPrefix(name, "lib") {
+			continue
+		}
+		_, runtimeVersion, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		if libs == nil {
+			libs = make(map[string]string)
+		}
+		libs[name] = strings.ReplaceAll(runtimeVersion, " ", "")
+	}
+	return version, compiler, config, libs
+}
+
+// parseHWAccels parses "ffmpeg -hwaccels" output, which lists one method
+// per line after a "Hardware acceleration methods:" header.
+func parseHWAccels(output string) []string {
+	var methods []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		methods = append(methods, line)
+	}
+	return methods
+}
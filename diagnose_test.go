@@ -0,0 +1,72 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersionOutput(t *testing.T) {
+	output := `ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers
+built with gcc 13 (Ubuntu 13.2.0-23ubuntu3)
+configuration: --prefix=/usr --enable-gpl --enable-libx264 --enable-vaapi
+libavutil      58. 29.100 / 58. 29.100
+libavcodec     60. 31.102 / 60. 31.102
+libswscale      7.  5.100 /  7.  5.100
+`
+	version, compiler, config, libs := parseVersionOutput(output)
+
+	if want := "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers"; version != want {
+		t.Errorf("version = %q, want %q", version, want)
+	}
+	if want := "gcc 13 (Ubuntu 13.2.0-23ubuntu3)"; compiler != want {
+		t.Errorf("compiler = %q, want %q", compiler, want)
+	}
+	if want := []string{"--prefix=/usr", "--enable-gpl", "--enable-libx264", "--enable-vaapi"}; !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %v, want %v", config, want)
+	}
+	wantLibs := map[string]string{
+		"libavutil":  "58.29.100",
+		"libavcodec": "60.31.102",
+		"libswscale": "7.5.100",
+	}
+	if !reflect.DeepEqual(libs, wantLibs) {
+		t.Errorf("libs = %v, want %v", libs, wantLibs)
+	}
+}
+
+func TestParseHWAccels(t *testing.T) {
+	output := "Hardware acceleration methods:\nvdpau\ncuda\nvaapi\n\n"
+	want := []string{"vdpau", "cuda", "vaapi"}
+	if got := parseHWAccels(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHWAccels() = %v, want %v", got, want)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	d := Diagnose()
+	if d.OS == "" || d.Arch == "" {
+		t.Error("Diagnose() should report the platform")
+	}
+	if !FFmpegAvailable() && len(d.Errors) == 0 {
+		t.Error("Diagnose() should report a missing ffmpeg")
+	}
+	if FFmpegAvailable() && d.FFmpeg.Version == "" {
+		t.Error("Diagnose() should report the ffmpeg version")
+	}
+	if _, err := json.Marshal(d); err != nil {
+		t.Errorf("json.Marshal() error: %v", err)
+	}
+}
+
+func TestDiagnoseHWAccels(t *testing.T) {
+	fakeFFmpeg(t, `case "$*" in
+*-hwaccels*) printf 'Hardware acceleration methods:\ncuda\nvaapi\n' ;;
+esac
+`)
+
+	d := Diagnose()
+	if want := HWAccels(); !reflect.DeepEqual(d.HWAccels, want) || len(want) != 2 {
+		t.Errorf("Diagnose() HWAccels = %v, want %v from HWAccels()", d.HWAccels, want)
+	}
+}
@@ -9,9 +9,9 @@ import (
 
 // Encoder represents a video encoder.
 type Encoder struct {
-	Name        string // Codec name (e.g., "h264_videotoolbox")
-	Description string // Human-readable description
-	Type        string // "software" or "hardware"
+	Name        string `json:"name"`        // Codec name (e.g., "h264_videotoolbox")
+	Description string `json:"description"` // Human-readable description
+	Type        string `json:"type"`        // "software" or "hardware"
 }
 
 // CommonEncoders lists well-known encoders by preference order.
@@ -86,16 +86,9 @@ func ListEncoders() ([]Encoder, error) {
 		name := parts[0]
 		desc := strings.Join(parts[1:], " ")
 
-		encType := "software"
-		if isHardwareEncoder(name) {
-			encType = "hardware"
-		}
-
-		encoders = append(encoders, Encoder{
-			Name:        name,
-			Description: desc,
-			Type:        encType,
-		})
+		enc := encoderByName(name)
+		enc.Description = desc
+		encoders = append(encoders, enc)
 	}
 
 	return encoders, nil
@@ -185,6 +178,16 @@ func HardwareEncoderAvailable() bool {
 	return best.Type == "hardware"
 }
 
+// encoderByName returns an Encoder for the named codec with its Type
+// inferred from the name.
+func encoderByName(name string) Encoder {
+	encType := "software"
+	if isHardwareEncoder(name) {
+		encType = "hardware"
+	}
+	return Encoder{Name: name, Type: encType}
+}
+
 // isHardwareEncoder checks if an encoder name indicates hardware acceleration.
 func isHardwareEncoder(name string) bool {
 	hwSuffixes := []string{
@@ -0,0 +1,212 @@
+package ffutil
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SoftwareFallback makes Run retry with the software equivalent encoder
+// (libx264 for H.264, libx265 for HEVC) when a hardware encoder fails to
+// initialize, for example because of a session limit or a driver error.
+// The retry decodes and scales on the CPU, maps the encoder preset and
+// translates hardware rate control options in Args (such as -cq,
+// -global_quality and -q:v) to -crf, dropping options only the hardware
+// encoder accepts. RunResult reports the encoder used.
+func (c *Command) SoftwareFallback() *Command {
+	c.softwareFallback = true
+	return c
+}
+
+// SoftwareEquivalent returns the software encoder for a hardware H.264 or
+// HEVC encoder: Libx264 or Libx265. It returns false for other encoders.
+func SoftwareEquivalent(enc Encoder) (Encoder, bool) {
+	if !isHardwareEncoder(enc.Name) {
+		return Encoder{}, false
+	}
+	switch {
+	case strings.HasPrefix(enc.Name, "h264_"):
+		return CommonEncoders.Libx264, true
+	case strings.HasPrefix(enc.Name, "hevc_"):
+		return CommonEncoders.Libx265, true
+	}
+	return Encoder{}, false
+}
+
+// encoderInitErrors are ffmpeg messages, emitted only by hardware encoders
+// and hardware devices, for a pipeline that failed to initialize. Generic
+// messages such as "Error while opening encoder" also follow invalid
+// software options, so they are not retried.
+var encoderInitErrors = []string{
+	"OpenEncodeSessionEx failed",
+	"InitializeEncoder failed",
+	"No capable devices found",
+	"No NVENC capable devices found",
+	"Cannot load libcuda",
+	"Cannot load nvcuda",
+	"Cannot load libnvidia-encode",
+	"Driver does not support the required nvenc API version",
+	"Failed to initialise VAAPI connection",
+	"Failed to create a VAAPI device",
+	"No usable encoding entrypoint found",
+	"Error creating a MFX session",
+	"Error initializing an internal MFX session",
+	"cannot create compression session",
+	"hwaccel initialisation returned error",
+}
+
+// isEncoderInitError reports whether an ffmpeg error is an encoder or
+// hardware initialization failure.
+func isEncoderInitError(err error) bool {
+	msg := err.Error()
+	for _, s := range encoderInitErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// softwareFallbackCommand returns a copy of the command using the software
+// equivalent of its hardware video encoder, or nil if there is none.
+func (c *Command) softwareFallbackCommand() *Command {
+	sw, ok := SoftwareEquivalent(encoderByName(c.videoCodec))
+	if !ok {
+		return nil
+	}
+	fallback := *c
+	fallback.videoCodec = sw.Name
+	fallback.hwaccel = nil
+	fallback.softwareFallback = false
+	fallback.preset = softwarePreset(c.preset)
+
+	crf, args := translateRateControl(slices.Concat(c.presetArgs, c.extraArgs), c.videoCodec, sw.Name)
+	fallback.presetArgs = nil
+	fallback.extraArgs = args
+	if fallback.crf == 0 {
+		fallback.crf = crf
+	}
+	return &fallback
+}
+
+// x264Presets are the presets shared by libx264 and libx265.
+var x264Presets = []string{
+	"ultrafast", "superfast", "veryfast", "faster", "fast",
+	"medium", "slow", "slower", "veryslow", "placebo",
+}
+
+// nvencPresets maps NVENC presets to their closest x264 presets.
+var nvencPresets = map[string]string{
+	"p1":      "ultrafast",
+	"p2":      "superfast",
+	"p3":      "veryfast",
+	"p4":      "medium",
+	"p5":      "slow",
+	"p6":      "slower",
+	"p7":      "veryslow",
+	"default": "medium",
+	"hp":      "fast",
+	"hq":      "slow",
+	"ll":      "faster",
+	"llhp":    "veryfast",
+	"llhq":    "fast",
+}
+
+// softwarePreset maps a hardware encoder preset to an x264 preset, or ""
+// if there is no equivalent.
+func softwarePreset(preset string) string {
+	if slices.Contains(x264Presets, preset) {
+		return preset
+	}
+	return nvencPresets[preset]
+}
+
+// x264Tunes are the -tune values accepted by libx264.
+var x264Tunes = []string{
+	"film", "animation", "grain", "stillimage", "fastdecode", "zerolatency", "psnr", "ssim",
+}
+
+// x265Tunes are the -tune values accepted by libx265.
+var x265Tunes = []string{
+	"grain", "zerolatency", "fastdecode", "animation", "psnr", "ssim",
+}
+
+// softwareTunes returns the -tune values accepted by a software encoder.
+func softwareTunes(encoder string) []string {
+	if encoder == CommonEncoders.Libx265.Name {
+		return x265Tunes
+	}
+	return x264Tunes
+}
+
+// hardwareEncoderOptions are the private options, each taking a value, of
+// hardware encoder families by name suffix. Options such as -rc-lookahead
+// that libx264 and libx265 accept with the same meaning are not listed.
+var hardwareEncoderOptions = map[string][]string{
+	"_nvenc": {
+		"-rc", "-rc:v", "-spatial_aq", "-spatial-aq", "-temporal_aq",
+		"-temporal-aq", "-aq-strength", "-b_ref_mode", "-multipass",
+		"-zerolatency", "-gpu", "-surfaces", "-delay", "-no-scenecut",
+		"-forced-idr",
+	},
+	"_qsv": {
+		"-look_ahead", "-look_ahead_depth", "-low_power", "-async_depth",
+		"-idr_interval", "-load_plugin",
+	},
+	"_vaapi": {
+		"-rc_mode", "-low_power", "-idr_interval", "-async_depth", "-quality",
+	},
+	"_amf": {
+		"-usage", "-quality", "-rc", "-rc:v", "-qp_i", "-qp_p", "-qp_b",
+		"-enforce_hrd", "-filler_data", "-vbaq", "-preanalysis",
+	},
+	"_videotoolbox": {
+		"-allow_sw", "-require_sw", "-realtime", "-prio_speed",
+	},
+}
+
+// hardwareOptions returns the private options of a hardware encoder.
+func hardwareOptions(encoder string) []string {
+	for suffix, opts := range hardwareEncoderOptions {
+		if strings.HasSuffix(encoder, suffix) {
+			return opts
+		}
+	}
+	return nil
+}
+
+// translateRateControl converts the quality options of the hardware
+// encoder hw to a CRF value and removes the options of hw and the -tune
+// values that the software encoder sw does not accept. NVENC -cq and -qp,
+// QSV and VA-API -global_quality map directly to CRF; VideoToolbox -q:v
+// (1-100, higher is better) is scaled to the 0-51 CRF range.
+func translateRateControl(args []string, hw, sw string) (crf int, out []string) {
+	hwOptions, tunes := hardwareOptions(hw), softwareTunes(sw)
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+		if i+1 >= len(args) {
+			out = append(out, opt)
+			break
+		}
+		value := args[i+1]
+		switch {
+		case opt == "-cq" || opt == "-cq:v" || opt == "-qp" || opt == "-qp:v" ||
+			opt == "-global_quality" || opt == "-global_quality:v":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				crf = min(n, 51)
+			}
+		case opt == "-q:v":
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q > 0 {
+				crf = int(math.Round(51 * (100 - min(q, 100)) / 100))
+			}
+		case opt == "-tune" && !slices.Contains(tunes, value):
+		case slices.Contains(hwOptions, opt):
+		default:
+			out = append(out, opt)
+			continue
+		}
+		i++ // skip the option value
+	}
+	return crf, out
+}
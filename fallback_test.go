@@ -0,0 +1,205 @@
+package ffutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSoftwareEquivalent(t *testing.T) {
+	tests := []struct {
+		encoder Encoder
+		want    string
+		ok      bool
+	}{
+		{CommonEncoders.H264NVENC, "libx264", true},
+		{CommonEncoders.H264VAAPI, "libx264", true},
+		{CommonEncoders.H264VideoToolbox, "libx264", true},
+		{CommonEncoders.HEVCQSV, "libx265", true},
+		{CommonEncoders.HEVCAMF, "libx265", true},
+		{CommonEncoders.Libx264, "", false},
+		{Encoder{Name: "av1_nvenc", Type: "hardware"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := SoftwareEquivalent(tt.encoder)
+		if got.Name != tt.want || ok != tt.ok {
+			t.Errorf("SoftwareEquivalent(%s) = %q, %v, want %q, %v", tt.encoder.Name, got.Name, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTranslateRateControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		hw       string
+		args     []string
+		wantCRF  int
+		wantArgs []string
+	}{
+		{
+			name:     "nvenc constant quality",
+			hw:       "h264_nvenc",
+			args:     []string{"-rc", "vbr", "-cq", "23", "-movflags", "+faststart"},
+			wantCRF:  23,
+			wantArgs: []string{"-movflags", "+faststart"},
+		},
+		{
+			name:    "qsv global quality",
+			hw:      "h264_qsv",
+			args:    []string{"-global_quality", "25", "-look_ahead", "1"},
+			wantCRF: 25,
+		},
+		{
+			name:    "videotoolbox quality",
+			hw:      "h264_videotoolbox",
+			args:    []string{"-q:v", "65", "-realtime", "1"},
+			wantCRF: 18,
+		},
+		{
+			name:     "hardware tune dropped",
+			hw:       "h264_nvenc",
+			args:     []string{"-tune", "hq", "-bf", "3"},
+			wantArgs: []string{"-bf", "3"},
+		},
+		{
+			name:     "x264 tune kept",
+			hw:       "h264_nvenc",
+			args:     []string{"-tune", "film", "-profile:v", "high"},
+			wantArgs: []string{"-tune", "film", "-profile:v", "high"},
+		},
+		{
+			name:     "x265 tune",
+			hw:       "hevc_nvenc",
+			args:     []string{"-tune", "film", "-tune", "grain"},
+			wantArgs: []string{"-tune", "grain"},
+		},
+		{
+			name:     "options of other encoders kept",
+			hw:       "h264_nvenc",
+			args:     []string{"-quality", "good", "-compression_level", "8", "-usage", "1", "-rc-lookahead", "40"},
+			wantArgs: []string{"-quality", "good", "-compression_level", "8", "-usage", "1", "-rc-lookahead", "40"},
+		},
+		{
+			name:     "amf options dropped",
+			hw:       "h264_amf",
+			args:     []string{"-quality", "speed", "-usage", "transcoding", "-delay", "2"},
+			wantArgs: []string{"-delay", "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw, _ := SoftwareEquivalent(encoderByName(tt.hw))
+			crf, args := translateRateControl(tt.args, tt.hw, sw.Name)
+			if crf != tt.wantCRF {
+				t.Errorf("crf = %d, want %d", crf, tt.wantCRF)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSoftwareFallbackCommand(t *testing.T) {
+	cmd := New().
+		Input("in.mp4").
+		VideoCodec("h264_nvenc").
+		Size(1280, 720).
+		Preset("p5").
+		PixelFormat("yuv420p").
+		Args("-rc", "vbr", "-cq", "21", "-movflags", "+faststart").
+		SoftwareFallback().
+		Output("out.mp4")
+	cmd.hwaccel = &hwPipeline{method: "cuda", decode: true}
+
+	fallback := cmd.softwareFallbackCommand()
+	if fallback == nil {
+		t.Fatal("softwareFallbackCommand() = nil")
+	}
+	got := strings.Join(fallback.Build(), " ")
+	for _, want := range []string{"-y -i in.mp4", "-c:v libx264", "-s 1280x720", "-crf 21", "-preset slow", "-pix_fmt yuv420p", "-movflags +faststart"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("fallback Build() = %q, missing %q", got, want)
+		}
+	}
+	for _, unwanted := range []string{"-hwaccel", "scale_cuda", "-rc", "-cq"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("fallback Build() = %q, should not contain %q", got, unwanted)
+		}
+	}
+	if cmd.videoCodec != "h264_nvenc" || cmd.hwaccel == nil {
+		t.Error("softwareFallbackCommand() should not modify the original command")
+	}
+
+	if New().VideoCodec("libx264").softwareFallbackCommand() != nil {
+		t.Error("softwareFallbackCommand() should be nil for a software encoder")
+	}
+}
+
+func TestIsEncoderInitError(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   bool
+	}{
+		{"[h264_nvenc @ 0x1] OpenEncodeSessionEx failed: out of memory (10)", true},
+		{"[h264_vaapi @ 0x1] Failed to initialise VAAPI connection: -1 (unknown libva error).", true},
+		{"[h264_vaapi @ 0x1] No usable encoding entrypoint found for profile VAProfileH264High (7).", true},
+		{"[libx264 @ 0x1] Error setting option foo to value bar.\nError while opening encoder for output stream #0:0 - maybe incorrect parameters", false},
+		{"Unknown encoder 'libfoo'", false},
+		{"in.mp4: No such file or directory", false},
+	}
+	for _, tt := range tests {
+		err := errors.New("ffmpeg failed: exit status 1\nstderr: " + tt.stderr)
+		if got := isEncoderInitError(err); got != tt.want {
+			t.Errorf("isEncoderInitError(%q) = %v, want %v", tt.stderr, got, tt.want)
+		}
+	}
+}
+
+// fakeFFmpeg installs a shell script named ffmpeg at the front of PATH.
+func fakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	fakeTool(t, "ffmpeg", script)
+}
+
+// fakeTool installs a shell script with the given name at the front of PATH.
+func fakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools require a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunSoftwareFallback(t *testing.T) {
+	fakeFFmpeg(t, `case "$*" in
+*h264_nvenc*) echo "OpenEncodeSessionEx failed: out of memory (10)" >&2; exit 1 ;;
+esac
+exit 0
+`)
+
+	cmd := New().Input("in.mp4").VideoCodec("h264_nvenc").Output(filepath.Join(t.TempDir(), "out.mp4"))
+	if err := cmd.Run(context.Background()); err == nil {
+		t.Fatal("Run() without SoftwareFallback should fail")
+	}
+
+	result, err := cmd.SoftwareFallback().RunResult(context.Background())
+	if err != nil {
+		t.Fatalf("RunResult() error: %v", err)
+	}
+	if result.VideoEncoder != "libx264" || !result.Fallback {
+		t.Errorf("RunResult() = %+v, want libx264 fallback", result)
+	}
+	if !isEncoderInitError(result.FallbackCause) {
+		t.Errorf("FallbackCause = %v, want the encoder error", result.FallbackCause)
+	}
+}
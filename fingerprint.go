@@ -0,0 +1,54 @@
+package ffutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Hash returns a canonical identifier of the command: the SHA-256 of its
+// ffmpeg arguments. Commands that build identical arguments have the same hash.
+func (c *Command) Hash() string {
+	h := sha256.New()
+	for _, arg := range c.Build() {
+		h.Write([]byte(arg))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fingerprint returns an identifier of the command together with the size
+// and modification time of its local input files, so that a changed input
+// produces a different fingerprint. Inputs that are URLs, pipes or lavfi
+// sources are identified by their path alone.
+func (c *Command) Fingerprint() (string, error) {
+	h := sha256.New()
+	h.Write([]byte(c.Hash()))
+	for _, in := range c.inputs {
+		fmt.Fprintf(h, "\x00%s", in.path)
+		if !isLocalInput(in) {
+			continue
+		}
+		fi, err := os.Stat(in.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat input: %w", err)
+		}
+		fmt.Fprintf(h, "\x00%d\x00%d", fi.Size(), fi.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isLocalInput reports whether the input refers to a regular local file.
+func isLocalInput(in inputSpec) bool {
+	switch {
+	case in.path == "-", in.format == "lavfi":
+		return false
+	case strings.Contains(in.path, "://"), strings.HasPrefix(in.path, "pipe:"):
+		return false
+	case in.loop && strings.Contains(in.path, "%"):
+		return false // image sequence pattern
+	}
+	return true
+}
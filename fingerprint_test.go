@@ -0,0 +1,79 @@
+package ffutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataOrder(t *testing.T) {
+	cmd := New().
+		Input("in.mp4").
+		Metadata("title", "A").
+		Metadata("artist", "B").
+		Metadata("album", "C").
+		Metadata("title", "D").
+		Output("out.mp4")
+
+	want := []string{
+		"-y", "-i", "in.mp4",
+		"-metadata", "title=D",
+		"-metadata", "artist=B",
+		"-metadata", "album=C",
+		"out.mp4",
+	}
+	for range 10 {
+		if got := cmd.Build(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Build() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := New().Input("in.mp4").VideoCodec("libx264").CRF(23).Output("out.mp4")
+	b := New().Input("in.mp4").CRF(23).VideoCodec("libx264").Output("out.mp4")
+	c := New().Input("in.mp4").VideoCodec("libx264").CRF(24).Output("out.mp4")
+
+	if a.Hash() != b.Hash() {
+		t.Error("Hash() should match for commands with identical arguments")
+	}
+	if a.Hash() == c.Hash() {
+		t.Error("Hash() should differ for commands with different arguments")
+	}
+	if len(a.Hash()) != 64 {
+		t.Errorf("Hash() length = %d, want 64", len(a.Hash()))
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.mp4")
+	if err := os.WriteFile(path, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := New().Input(path).Input("https://example.com/a.mp4").Output("out.mp4")
+	first, err := cmd.Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint() error: %v", err)
+	}
+
+	again, _ := cmd.Fingerprint()
+	if first != again {
+		t.Error("Fingerprint() should be stable for unchanged inputs")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := cmd.Fingerprint()
+	if first == changed {
+		t.Error("Fingerprint() should change when an input changes")
+	}
+
+	if _, err := New().Input("/nonexistent/in.mp4").Output("out.mp4").Fingerprint(); err == nil {
+		t.Error("Fingerprint() should fail for a missing local input")
+	}
+}
@@ -0,0 +1,336 @@
+package ffutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frame contains information about a decoded frame.
+type Frame struct {
+	// MediaType is the frame type ("video" or "audio")
+	MediaType string `json:"mediaType"`
+
+	// StreamIndex is the index of the stream the frame belongs to
+	StreamIndex int `json:"streamIndex"`
+
+	// KeyFrame indicates if the frame is a keyframe
+	KeyFrame bool `json:"keyFrame"`
+
+	// PTS is the presentation timestamp
+	PTS time.Duration `json:"pts"`
+
+	// DTS is the decoding timestamp of the packet the frame came from
+	DTS time.Duration `json:"dts"`
+
+	// Duration is the frame duration
+	Duration time.Duration `json:"duration"`
+
+	// Size is the size of the packet the frame came from in bytes
+	Size int `json:"size"`
+
+	// PictType is the picture type ("I", "P", "B"; empty for audio)
+	PictType string `json:"pictType,omitempty"`
+
+	// Width and Height are the frame dimensions (0 for audio)
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// SideData contains frame side data, such as HDR metadata
+	SideData []SideData `json:"sideData,omitempty"`
+}
+
+// Packet contains information about a demuxed packet.
+type Packet struct {
+	// CodecType is the stream type ("video", "audio", "subtitle", "data")
+	CodecType string `json:"codecType"`
+
+	// StreamIndex is the index of the stream the packet belongs to
+	StreamIndex int `json:"streamIndex"`
+
+	// PTS is the presentation timestamp
+	PTS time.Duration `json:"pts"`
+
+	// DTS is the decoding timestamp
+	DTS time.Duration `json:"dts"`
+
+	// Duration is the packet duration
+	Duration time.Duration `json:"duration"`
+
+	// Size is the packet size in bytes
+	Size int `json:"size"`
+
+	// Key indicates if the packet contains a keyframe
+	Key bool `json:"key"`
+
+	// Flags are the raw ffprobe packet flags (e.g., "K__")
+	Flags string `json:"flags"`
+
+	// SideData contains packet side data
+	SideData []SideData `json:"sideData,omitempty"`
+}
+
+// SideData is a side data entry as reported by ffprobe.
+type SideData map[string]any
+
+// Type returns the side data type (e.g., "Mastering display metadata").
+func (s SideData) Type() string {
+	t, _ := s["side_data_type"].(string)
+	return t
+}
+
+// FrameOptions limits which frames or packets are read.
+type FrameOptions struct {
+	// Stream selects streams using an ffprobe stream specifier (e.g., "v:0").
+	// Empty reads all streams.
+	Stream string
+
+	// Start is the time in seconds to seek to before reading.
+	Start float64
+
+	// Duration limits reading to this many seconds after Start.
+	Duration float64
+
+	// MaxCount limits reading to this many packets per stream after Start.
+	// It is ignored if Duration is set.
+	MaxCount int
+
+	// KeyFramesOnly skips decoding of non-keyframes. Only applies to frames.
+	KeyFramesOnly bool
+}
+
+// readIntervals returns the ffprobe -read_intervals value for the options.
+func (o FrameOptions) readIntervals() string {
+	if o.Start <= 0 && o.Duration <= 0 && o.MaxCount <= 0 {
+		return ""
+	}
+	spec := ""
+	if o.Start > 0 {
+		spec = formatDuration(o.Start)
+	}
+	spec += "%"
+	if o.Duration > 0 {
+		spec += "+" + formatDuration(o.Duration)
+	} else if o.MaxCount > 0 {
+		spec += "+#" + strconv.Itoa(o.MaxCount)
+	}
+	return spec
+}
+
+// args returns the ffprobe arguments to read the given section.
+func (o FrameOptions) args(section, path string) []string {
+	args := []string{"-v", "error", "-print_format", "json"}
+	if o.Stream != "" {
+		args = append(args, "-select_streams", o.Stream)
+	}
+	if o.KeyFramesOnly && section == "frames" {
+		args = append(args, "-skip_frame", "nokey")
+	}
+	if ri := o.readIntervals(); ri != "" {
+		args = append(args, "-read_intervals", ri)
+	}
+	return append(args, "-show_"+section, path)
+}
+
+// ffprobeFrame represents a frame in ffprobe JSON output.
+type ffprobeFrame struct {
+	MediaType               string     `json:"media_type"`
+	StreamIndex             int        `json:"stream_index"`
+	KeyFrame                int        `json:"key_frame"`
+	PTSTime                 string     `json:"pts_time"`
+	BestEffortTimestampTime string     `json:"best_effort_timestamp_time"`
+	PktDTSTime              string     `json:"pkt_dts_time"`
+	DurationTime            string     `json:"duration_time"`
+	PktDurationTime         string     `json:"pkt_duration_time"`
+	PktSize                 string     `json:"pkt_size"`
+	PictType                string     `json:"pict_type"`
+	Width                   int        `json:"width"`
+	Height                  int        `json:"height"`
+	SideDataList            []SideData `json:"side_data_list"`
+}
+
+// ffprobePacket represents a packet in ffprobe JSON output.
+type ffprobePacket struct {
+	CodecType    string     `json:"codec_type"`
+	StreamIndex  int        `json:"stream_index"`
+	PTSTime      string     `json:"pts_time"`
+	DTSTime      string     `json:"dts_time"`
+	DurationTime string     `json:"duration_time"`
+	Size         string     `json:"size"`
+	Flags        string     `json:"flags"`
+	SideDataList []SideData `json:"side_data_list"`
+}
+
+func (f ffprobeFrame) frame() Frame {
+	pts := f.PTSTime
+	if pts == "" {
+		pts = f.BestEffortTimestampTime
+	}
+	dur := f.DurationTime
+	if dur == "" {
+		dur = f.PktDurationTime
+	}
+	size, _ := strconv.Atoi(f.PktSize)
+	return Frame{
+		MediaType:   f.MediaType,
+		StreamIndex: f.StreamIndex,
+		KeyFrame:    f.KeyFrame == 1,
+		PTS:         parseTime(pts),
+		DTS:         parseTime(f.PktDTSTime),
+		Duration:    parseTime(dur),
+		Size:        size,
+		PictType:    f.PictType,
+		Width:       f.Width,
+		Height:      f.Height,
+		SideData:    f.SideDataList,
+	}
+}
+
+func (p ffprobePacket) packet() Packet {
+	size, _ := strconv.Atoi(p.Size)
+	return Packet{
+		CodecType:   p.CodecType,
+		StreamIndex: p.StreamIndex,
+		PTS:         parseTime(p.PTSTime),
+		DTS:         parseTime(p.DTSTime),
+		Duration:    parseTime(p.DurationTime),
+		Size:        size,
+		Key:         strings.HasPrefix(p.Flags, "K"),
+		Flags:       p.Flags,
+		SideData:    p.SideDataList,
+	}
+}
+
+// Frames returns an iterator over the decoded frames of a media file.
+// Frames are streamed from ffprobe as they are read, so memory use does
+// not grow with the file length. Stopping the iteration stops ffprobe.
+func Frames(ctx context.Context, path string, opts FrameOptions) iter.Seq2[Frame, error] {
+	return func(yield func(Frame, error) bool) {
+		for raw, err := range probeSection[ffprobeFrame](ctx, opts.args("frames", path), "frames") {
+			if !yield(raw.frame(), err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Packets returns an iterator over the demuxed packets of a media file.
+// Packets are streamed from ffprobe as they are read, so memory use does
+// not grow with the file length. Stopping the iteration stops ffprobe.
+func Packets(ctx context.Context, path string, opts FrameOptions) iter.Seq2[Packet, error] {
+	return func(yield func(Packet, error) bool) {
+		for raw, err := range probeSection[ffprobePacket](ctx, opts.args("packets", path), "packets") {
+			if !yield(raw.packet(), err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// probeSection runs ffprobe and decodes the elements of the named top-level
+// JSON array one at a time.
+func probeSection[T any](ctx context.Context, args []string, section string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "ffprobe", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			yield(zero, fmt.Errorf("ffprobe failed: %w", err))
+			return
+		}
+
+		stopped := false
+		decodeErr := decodeArray(stdout, section, func(raw json.RawMessage) bool {
+			var v T
+			if err := json.Unmarshal(raw, &v); err != nil {
+				yield(zero, fmt.Errorf("failed to parse ffprobe output: %w", err))
+				stopped = true
+				return false
+			}
+			stopped = !yield(v, nil)
+			return !stopped
+		})
+		if stopped {
+			cancel()
+			_ = cmd.Wait()
+			return
+		}
+
+		// Drain remaining output so ffprobe can exit.
+		_, _ = io.Copy(io.Discard, stdout)
+		waitErr := cmd.Wait()
+		switch {
+		case waitErr != nil:
+			yield(zero, fmt.Errorf("ffprobe failed: %w (stderr: %s)", waitErr, stderr.String()))
+		case decodeErr != nil:
+			yield(zero, fmt.Errorf("failed to parse ffprobe output: %w", decodeErr))
+		}
+	}
+}
+
+// decodeArray reads a JSON object from r and calls fn with each element of
+// the array stored under key. It stops early if fn returns false.
+func decodeArray(r io.Reader, key string, fn func(json.RawMessage) bool) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil { // {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != key {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := dec.Token(); err != nil { // [
+			return err
+		}
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if !fn(raw) {
+				return nil
+			}
+		}
+		if _, err := dec.Token(); err != nil { // ]
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTime parses an ffprobe time value in seconds.
+// It returns 0 for missing or "N/A" values.
+func parseTime(s string) time.Duration {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return secondsToDuration(secs)
+}
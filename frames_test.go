@@ -0,0 +1,107 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameOptionsArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    FrameOptions
+		section string
+		want    string
+	}{
+		{"all frames", FrameOptions{}, "frames", "-v error -print_format json -show_frames in.mp4"},
+		{"stream and keyframes", FrameOptions{Stream: "v:0", KeyFramesOnly: true}, "frames", "-select_streams v:0 -skip_frame nokey"},
+		{"keyframes ignored for packets", FrameOptions{KeyFramesOnly: true}, "packets", "-v error -print_format json -show_packets in.mp4"},
+		{"start and duration", FrameOptions{Start: 10, Duration: 5}, "packets", "-read_intervals 10.000%+5.000"},
+		{"count", FrameOptions{MaxCount: 100}, "packets", "-read_intervals %+#100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(tt.opts.args(tt.section, "in.mp4"), " ")
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("args() = %q, want to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeArray(t *testing.T) {
+	data := `{
+  "packets": [
+    {"codec_type": "video", "stream_index": 0, "pts_time": "0.000000", "dts_time": "-0.033367", "duration_time": "0.033367", "size": "15432", "flags": "K__"},
+    {"codec_type": "video", "stream_index": 0, "pts_time": "0.133467", "dts_time": "0.000000", "size": "812", "flags": "___"},
+    {"codec_type": "audio", "stream_index": 1, "pts_time": "0.021333", "size": "371", "flags": "K__"}
+  ]
+}`
+	var packets []Packet
+	err := decodeArray(strings.NewReader(data), "packets", func(raw json.RawMessage) bool {
+		var p ffprobePacket
+		if err := json.Unmarshal(raw, &p); err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, p.packet())
+		return len(packets) < 2
+	})
+	if err != nil {
+		t.Fatalf("decodeArray() error: %v", err)
+	}
+
+	if len(packets) != 2 {
+		t.Fatalf("decodeArray() decoded %d packets, want 2 (stopped early)", len(packets))
+	}
+
+	if !packets[0].Key || packets[0].Size != 15432 || packets[0].DTS != -33367*time.Microsecond {
+		t.Errorf("packets[0] = %+v", packets[0])
+	}
+
+	if packets[1].Key || packets[1].PTS != 133467*time.Microsecond {
+		t.Errorf("packets[1] = %+v", packets[1])
+	}
+}
+
+func TestFfprobeFrame(t *testing.T) {
+	data := `{"media_type": "video", "stream_index": 0, "key_frame": 1, "best_effort_timestamp_time": "1.001000",
+	  "pkt_duration_time": "0.033367", "pkt_size": "2048", "pict_type": "I", "width": 1280, "height": 720,
+	  "side_data_list": [{"side_data_type": "Mastering display metadata"}]}`
+	var raw ffprobeFrame
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatal(err)
+	}
+	f := raw.frame()
+
+	if !f.KeyFrame || f.PictType != "I" || f.Size != 2048 {
+		t.Errorf("frame() = %+v", f)
+	}
+
+	if f.PTS != 1001*time.Millisecond {
+		t.Errorf("frame().PTS = %v, want best effort timestamp 1.001s", f.PTS)
+	}
+
+	if f.Duration != 33367*time.Microsecond {
+		t.Errorf("frame().Duration = %v, want 33.367ms", f.Duration)
+	}
+
+	if len(f.SideData) != 1 || f.SideData[0].Type() != "Mastering display metadata" {
+		t.Errorf("frame().SideData = %v", f.SideData)
+	}
+}
+
+func TestPacketsNonExistentFile(t *testing.T) {
+	if !FFprobeAvailable() {
+		t.Skip("ffprobe not available")
+	}
+
+	var gotErr error
+	for _, err := range Packets(t.Context(), "/nonexistent/file.mp4", FrameOptions{}) {
+		gotErr = err
+	}
+	if gotErr == nil {
+		t.Error("Packets() should yield an error for non-existent file")
+	}
+}
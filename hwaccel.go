@@ -0,0 +1,232 @@
+package ffutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultVAAPIDevice is the VA-API device used when no render node is found.
+const DefaultVAAPIDevice = "/dev/dri/renderD128"
+
+// hwPipeline describes hardware decoding and filtering for a hardware encoder.
+type hwPipeline struct {
+	method string // hwaccel method: "cuda", "vaapi", "qsv" or "videotoolbox"
+	device string // VA-API device node
+	decode bool   // decode with the hwaccel method
+}
+
+// hwaccelMethod returns the hwaccel method matching a hardware encoder,
+// or "" if the encoder has no known hardware pipeline.
+func hwaccelMethod(encoder string) string {
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		return "cuda"
+	case strings.HasSuffix(encoder, "_vaapi"):
+		return "vaapi"
+	case strings.HasSuffix(encoder, "_qsv"):
+		return "qsv"
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		return "videotoolbox"
+	}
+	return ""
+}
+
+// HWAccel sets enc as the video codec and builds a hardware pipeline for it:
+// hardware decoding (-hwaccel, -hwaccel_output_format), device
+// initialization (e.g., -vaapi_device) and GPU scaling with scale_cuda,
+// scale_vaapi or scale_qsv. Frames stay on the GPU unless a VideoFilter or
+// a PixelFormat other than yuv420p or nv12 requires CPU filtering, in which
+// case frames are downloaded and uploaded again as the encoder needs.
+//
+// Build assumes ffmpeg supports the hwaccel method. If the installed ffmpeg
+// does not, Run decodes and scales on the CPU instead. Software encoders
+// use the CPU pipeline.
+func (c *Command) HWAccel(enc Encoder) *Command {
+	c.videoCodec = enc.Name
+	c.hwaccel = nil
+
+	method := hwaccelMethod(enc.Name)
+	if enc.Type != "hardware" || method == "" {
+		return c
+	}
+	c.hwaccel = &hwPipeline{
+		method: method,
+		decode: true,
+	}
+	if method == "vaapi" {
+		c.hwaccel.device = vaapiDevice()
+	}
+	return c
+}
+
+// HWAccelDevice sets the device node for hardware pipelines that need one,
+// such as VA-API (default: the first /dev/dri/renderD* node).
+func (c *Command) HWAccelDevice(device string) *Command {
+	if c.hwaccel != nil {
+		c.hwaccel.device = device
+	}
+	return c
+}
+
+// HWAccels returns the hardware acceleration methods supported by the
+// installed ffmpeg, as listed by "ffmpeg -hwaccels".
+func HWAccels() []string {
+	methods, _ := listHWAccels()
+	return methods
+}
+
+// listHWAccels runs "ffmpeg -hwaccels" and returns the listed methods.
+func listHWAccels() ([]string, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-hwaccels")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return parseHWAccels(stdout.String()), nil
+}
+
+// withSupportedHWAccel returns the command, or a copy that decodes on the
+// CPU if the installed ffmpeg does not support its hwaccel method.
+func (c *Command) withSupportedHWAccel() *Command {
+	if c.hwaccel == nil || !c.hwaccel.decode || slices.Contains(HWAccels(), c.hwaccel.method) {
+		return c
+	}
+	cpu := *c
+	pipeline := *c.hwaccel
+	pipeline.decode = false
+	cpu.hwaccel = &pipeline
+	return &cpu
+}
+
+// qualityArgs returns the options for the CRF setting. Hardware encoders
+// do not support -crf, so the value is passed as the encoder's constant
+// quality option instead: -cq for NVENC, -qp for VA-API and AMF,
+// -global_quality for QSV and -q:v (1-100, higher is better) for
+// VideoToolbox. It is dropped for other hardware encoders.
+func (c *Command) qualityArgs() []string {
+	if c.crf <= 0 {
+		return nil
+	}
+	crf := strconv.Itoa(c.crf)
+	if !isHardwareEncoder(c.videoCodec) {
+		return []string{"-crf", crf}
+	}
+	switch {
+	case strings.HasSuffix(c.videoCodec, "_nvenc"):
+		return []string{"-cq", crf}
+	case strings.HasSuffix(c.videoCodec, "_vaapi"):
+		return []string{"-qp", crf}
+	case strings.HasSuffix(c.videoCodec, "_qsv"):
+		return []string{"-global_quality", crf}
+	case strings.HasSuffix(c.videoCodec, "_amf"):
+		return []string{"-rc", "cqp", "-qp_i", crf, "-qp_p", crf}
+	case strings.HasSuffix(c.videoCodec, "_videotoolbox"):
+		q := math.Round(100 - float64(min(c.crf, 51))*100/51)
+		return []string{"-q:v", strconv.Itoa(max(int(q), 1))}
+	}
+	return nil
+}
+
+// vaapiDevice returns the first DRM render node, or DefaultVAAPIDevice.
+func vaapiDevice() string {
+	nodes, _ := filepath.Glob("/dev/dri/renderD*")
+	for _, node := range nodes {
+		if _, err := os.Stat(node); err == nil {
+			return node
+		}
+	}
+	return DefaultVAAPIDevice
+}
+
+// gpuFrames reports whether decoded frames can stay in GPU memory through
+// filtering and encoding.
+func (c *Command) gpuFrames() bool {
+	p := c.hwaccel
+	if p == nil || !p.decode || p.method == "videotoolbox" {
+		return false
+	}
+	if c.filterVideo != "" || c.filterComplex != "" {
+		return false
+	}
+	switch c.pixelFormat {
+	case "", "yuv420p", "nv12":
+		return true
+	}
+	return false
+}
+
+// hwGlobalArgs returns the device initialization options of the pipeline.
+func (c *Command) hwGlobalArgs() []string {
+	switch c.hwaccel.method {
+	case "vaapi":
+		return []string{"-vaapi_device", c.hwaccel.device}
+	case "qsv":
+		return []string{"-init_hw_device", "qsv=hw", "-filter_hw_device", "hw"}
+	}
+	return nil
+}
+
+// hwInputArgs returns the hardware decoding options for the main input.
+func (c *Command) hwInputArgs() []string {
+	if !c.hwaccel.decode {
+		return nil
+	}
+	args := []string{"-hwaccel", c.hwaccel.method}
+	if c.gpuFrames() {
+		args = append(args, "-hwaccel_output_format", c.hwaccel.method)
+	}
+	return args
+}
+
+// hwVideoFilter returns the video filter chain of the pipeline, including
+// scaling, which replaces -s and -pix_fmt.
+func (c *Command) hwVideoFilter() string {
+	scaled := c.width > 0 && c.height > 0
+	if c.gpuFrames() {
+		if !scaled {
+			return ""
+		}
+		switch c.hwaccel.method {
+		case "cuda":
+			return fmt.Sprintf("scale_cuda=%d:%d", c.width, c.height)
+		case "vaapi":
+			return fmt.Sprintf("scale_vaapi=w=%d:h=%d", c.width, c.height)
+		case "qsv":
+			return fmt.Sprintf("scale_qsv=w=%d:h=%d", c.width, c.height)
+		}
+	}
+
+	var filters []string
+	if c.filterVideo != "" {
+		filters = append(filters, c.filterVideo)
+	}
+	if scaled {
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", c.width, c.height))
+	}
+	if c.hwaccel.method == "vaapi" {
+		// VA-API encoders only accept frames in GPU memory.
+		filters = append(filters, "format="+vaapiUploadFormat(c.pixelFormat), "hwupload")
+	} else if c.pixelFormat != "" {
+		filters = append(filters, "format="+c.pixelFormat)
+	}
+	return strings.Join(filters, ",")
+}
+
+// vaapiUploadFormat maps a pixel format to a format VA-API can upload.
+func vaapiUploadFormat(pixelFormat string) string {
+	switch pixelFormat {
+	case "", "yuv420p", "nv12":
+		return "nv12"
+	case "yuv420p10le", "p010le", "p010":
+		return "p010"
+	}
+	return pixelFormat
+}
@@ -0,0 +1,205 @@
+package ffutil
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHWAccelBuild(t *testing.T) {
+	pipeline := func(codec string, p hwPipeline) *Command {
+		c := New().Input("in.mp4").VideoCodec(codec)
+		c.hwaccel = &p
+		return c.Output("out.mp4")
+	}
+
+	tests := []struct {
+		name        string
+		cmd         *Command
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "cuda gpu frames",
+			cmd:  pipeline("h264_nvenc", hwPipeline{method: "cuda", decode: true}).Size(1280, 720).PixelFormat("yuv420p"),
+			contains: []string{
+				"-hwaccel cuda -hwaccel_output_format cuda -i in.mp4",
+				"-vf scale_cuda=1280:720",
+				"-c:v h264_nvenc",
+			},
+			notContains: []string{"-s ", "-pix_fmt"},
+		},
+		{
+			name: "vaapi gpu frames",
+			cmd:  pipeline("h264_vaapi", hwPipeline{method: "vaapi", device: "/dev/dri/renderD129", decode: true}).Size(1280, 720),
+			contains: []string{
+				"-y -vaapi_device /dev/dri/renderD129",
+				"-hwaccel vaapi -hwaccel_output_format vaapi -i in.mp4",
+				"-vf scale_vaapi=w=1280:h=720",
+			},
+		},
+		{
+			name: "vaapi with cpu filter",
+			cmd:  pipeline("h264_vaapi", hwPipeline{method: "vaapi", device: DefaultVAAPIDevice, decode: true}).VideoFilter("hflip").Size(1280, 720),
+			contains: []string{
+				"-hwaccel vaapi -i in.mp4",
+				"-vf hflip,scale=1280:720,format=nv12,hwupload",
+			},
+			notContains: []string{"-hwaccel_output_format"},
+		},
+		{
+			name:        "cuda without hardware decoding",
+			cmd:         pipeline("h264_nvenc", hwPipeline{method: "cuda"}).Size(1280, 720),
+			contains:    []string{"-y -i in.mp4", "-vf scale=1280:720", "-c:v h264_nvenc"},
+			notContains: []string{"-hwaccel"},
+		},
+		{
+			name: "qsv with 10-bit output",
+			cmd:  pipeline("hevc_qsv", hwPipeline{method: "qsv", decode: true}).PixelFormat("yuv420p10le"),
+			contains: []string{
+				"-init_hw_device qsv=hw -filter_hw_device hw",
+				"-hwaccel qsv -i in.mp4",
+				"-vf format=yuv420p10le",
+			},
+			notContains: []string{"-hwaccel_output_format", "-pix_fmt"},
+		},
+		{
+			name:        "videotoolbox",
+			cmd:         pipeline("h264_videotoolbox", hwPipeline{method: "videotoolbox", decode: true}).Size(640, 360),
+			contains:    []string{"-hwaccel videotoolbox -i in.mp4", "-vf scale=640:360"},
+			notContains: []string{"-hwaccel_output_format"},
+		},
+		{
+			name:        "no scaling",
+			cmd:         pipeline("h264_nvenc", hwPipeline{method: "cuda", decode: true}),
+			contains:    []string{"-hwaccel_output_format cuda"},
+			notContains: []string{"-vf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(tt.cmd.Build(), " ")
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("Build() = %q, missing %q", got, want)
+				}
+			}
+			for _, unwanted := range tt.notContains {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("Build() = %q, should not contain %q", got, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestHWAccel(t *testing.T) {
+	c := New().HWAccel(CommonEncoders.Libx264)
+	if c.videoCodec != "libx264" || c.hwaccel != nil {
+		t.Errorf("HWAccel(Libx264) codec = %q, pipeline = %v, want libx264 without pipeline", c.videoCodec, c.hwaccel)
+	}
+
+	c = New().HWAccel(CommonEncoders.H264VAAPI).HWAccelDevice("/dev/dri/renderD130")
+	if c.hwaccel == nil || c.hwaccel.method != "vaapi" || c.hwaccel.device != "/dev/dri/renderD130" || !c.hwaccel.decode {
+		t.Fatalf("HWAccel(H264VAAPI) pipeline = %+v", c.hwaccel)
+	}
+
+	c.VideoCodec("libx264")
+	if c.hwaccel != nil {
+		t.Error("VideoCodec() with a different codec should remove the pipeline")
+	}
+}
+
+func TestHWAccelJobSpec(t *testing.T) {
+	cmd := New().Input("in.mp4").VideoCodec("h264_vaapi").Size(1280, 720).Output("out.mp4")
+	cmd.hwaccel = &hwPipeline{method: "vaapi", device: DefaultVAAPIDevice, decode: true}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	var decoded Command
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+	if got, want := decoded.Build(), cmd.Build(); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip Build() = %v, want %v", got, want)
+	}
+}
+
+func TestHWAccelMethod(t *testing.T) {
+	tests := map[string]string{
+		"h264_nvenc":        "cuda",
+		"hevc_vaapi":        "vaapi",
+		"h264_qsv":          "qsv",
+		"hevc_videotoolbox": "videotoolbox",
+		"h264_amf":          "",
+		"libx264":           "",
+	}
+	for encoder, want := range tests {
+		if got := hwaccelMethod(encoder); got != want {
+			t.Errorf("hwaccelMethod(%q) = %q, want %q", encoder, got, want)
+		}
+	}
+}
+
+func TestWithSupportedHWAccel(t *testing.T) {
+	fakeFFmpeg(t, `printf 'Hardware acceleration methods:\nvaapi\n'`)
+
+	c := New().Input("in.mp4").HWAccel(CommonEncoders.H264NVENC).Output("out.mp4")
+	cpu := c.withSupportedHWAccel()
+	if cpu == c || cpu.hwaccel.decode {
+		t.Error("withSupportedHWAccel() should decode on the CPU when cuda is not supported")
+	}
+	if !c.hwaccel.decode {
+		t.Error("withSupportedHWAccel() should not modify the original command")
+	}
+
+	c = New().Input("in.mp4").HWAccel(CommonEncoders.H264VAAPI).Output("out.mp4")
+	if c.withSupportedHWAccel() != c {
+		t.Error("withSupportedHWAccel() should keep a supported pipeline")
+	}
+}
+
+func TestRunWithOutputHWAccelFallback(t *testing.T) {
+	fakeFFmpeg(t, `case "$*" in
+*-hwaccels*) printf 'Hardware acceleration methods:\nvaapi\n'; exit 0 ;;
+*"-hwaccel "*) echo "cuda not supported" >&2; exit 1 ;;
+esac
+echo "decoded on the CPU" >&2
+`)
+
+	output, err := New().Input("in.mp4").HWAccel(CommonEncoders.H264NVENC).Output("out.mp4").RunWithOutput(context.Background())
+	if err != nil {
+		t.Fatalf("RunWithOutput() error: %v", err)
+	}
+	if !strings.Contains(string(output), "decoded on the CPU") {
+		t.Errorf("RunWithOutput() output = %q", output)
+	}
+}
+
+func TestQualityArgs(t *testing.T) {
+	tests := []struct {
+		codec string
+		crf   int
+		want  []string
+	}{
+		{"libx264", 23, []string{"-crf", "23"}},
+		{"h264_nvenc", 23, []string{"-cq", "23"}},
+		{"hevc_vaapi", 25, []string{"-qp", "25"}},
+		{"h264_qsv", 23, []string{"-global_quality", "23"}},
+		{"h264_amf", 20, []string{"-rc", "cqp", "-qp_i", "20", "-qp_p", "20"}},
+		{"h264_videotoolbox", 18, []string{"-q:v", "65"}},
+		{"h264_v4l2m2m", 23, nil},
+		{"libx264", 0, nil},
+	}
+	for _, tt := range tests {
+		got := New().VideoCodec(tt.codec).CRF(tt.crf).qualityArgs()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("qualityArgs() for %s CRF %d = %v, want %v", tt.codec, tt.crf, got, tt.want)
+		}
+	}
+}
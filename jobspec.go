@@ -0,0 +1,407 @@
+package ffutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// JobSpecVersion is the current version of the job spec schema.
+const JobSpecVersion = 1
+
+// Input roles in a job spec. Plain inputs have an empty role.
+const (
+	InputRoleSubtitle = "subtitle"
+	InputRoleCoverArt = "coverArt"
+)
+
+// JobSpec is a serializable description of a Command, suitable for storing
+// or transmitting transcode jobs. It round-trips the full Command state
+// except the Logger.
+type JobSpec struct {
+	// Version is the schema version (see JobSpecVersion)
+	Version int `json:"version"`
+
+	Inputs        []JobInput    `json:"inputs"`
+	Output        string        `json:"output,omitempty"`
+	Overwrite     *bool         `json:"overwrite,omitempty"`
+	VideoCodec    string        `json:"videoCodec,omitempty"`
+	AudioCodec    string        `json:"audioCodec,omitempty"`
+	SubtitleCodec string        `json:"subtitleCodec,omitempty"`
+	CopyVideo     bool          `json:"copyVideo,omitempty"`
+	CopyAudio     bool          `json:"copyAudio,omitempty"`
+	NoVideo       bool          `json:"noVideo,omitempty"`
+	NoAudio       bool          `json:"noAudio,omitempty"`
+	VideoBitrate  string        `json:"videoBitrate,omitempty"`
+	AudioBitrate  string        `json:"audioBitrate,omitempty"`
+	Width         int           `json:"width,omitempty"`
+	Height        int           `json:"height,omitempty"`
+	FPS           int           `json:"fps,omitempty"`
+	CRF           int           `json:"crf,omitempty"`
+	Preset        string        `json:"preset,omitempty"`
+	PixelFormat   string        `json:"pixelFormat,omitempty"`
+	AudioRate     int           `json:"audioRate,omitempty"`
+	Channels      int           `json:"channels,omitempty"`
+	Duration      float64       `json:"duration,omitempty"`
+	StartTime     float64       `json:"startTime,omitempty"`
+	VideoFilter   string        `json:"videoFilter,omitempty"`
+	AudioFilter   string        `json:"audioFilter,omitempty"`
+	FilterComplex string        `json:"filterComplex,omitempty"`
+	Maps          []string      `json:"maps,omitempty"`
+	MapMetadata   string        `json:"mapMetadata,omitempty"`
+	MapChapters   string        `json:"mapChapters,omitempty"`
+	Metadata      []JobMetadata `json:"metadata,omitempty"`
+	Dispositions  []JobMetadata `json:"dispositions,omitempty"`
+	Args          []string      `json:"args,omitempty"`
+
+	// PresetArgs are the Args of the last applied Preset, which a later
+	// Preset.Apply replaces
+	PresetArgs []string `json:"presetArgs,omitempty"`
+
+	Threads              int `json:"threads,omitempty"`
+	FilterThreads        int `json:"filterThreads,omitempty"`
+	FilterComplexThreads int `json:"filterComplexThreads,omitempty"`
+
+	LogLevel    string `json:"logLevel,omitempty"`
+	HideBanner  bool   `json:"hideBanner,omitempty"`
+	Stats       bool   `json:"stats,omitempty"`
+	StderrLimit int    `json:"stderrLimit,omitempty"`
+
+	// GracePeriod is the graceful stop timeout in seconds
+	GracePeriod float64 `json:"gracePeriod,omitempty"`
+
+	// AtomicOutput writes to a temporary file renamed into place on success
+	AtomicOutput bool `json:"atomicOutput,omitempty"`
+
+	// HWAccel is the hardware pipeline set by Command.HWAccel
+	HWAccel *JobHWAccel `json:"hwaccel,omitempty"`
+
+	// SoftwareFallback retries with a software encoder when the hardware
+	// encoder fails to initialize
+	SoftwareFallback bool `json:"softwareFallback,omitempty"`
+
+	// SkipValidation disables validation when the command is run
+	SkipValidation bool `json:"skipValidation,omitempty"`
+}
+
+// JobInput is an input file in a job spec.
+type JobInput struct {
+	Path      string  `json:"path"`
+	Format    string  `json:"format,omitempty"`
+	FrameRate int     `json:"frameRate,omitempty"`
+	Loop      bool    `json:"loop,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+	StartTime float64 `json:"startTime,omitempty"`
+
+	// Options are extra input options placed before the input
+	Options []string `json:"options,omitempty"`
+
+	// Role is InputRoleSubtitle or InputRoleCoverArt for inputs added with
+	// SubtitleTrack or CoverArt, and empty otherwise
+	Role string `json:"role,omitempty"`
+
+	// Language is the subtitle track language for subtitle inputs
+	Language string `json:"language,omitempty"`
+}
+
+// JobHWAccel is a hardware decoding and filtering pipeline in a job spec.
+type JobHWAccel struct {
+	// Method is the hwaccel method: "cuda", "vaapi", "qsv" or "videotoolbox"
+	Method string `json:"method"`
+
+	// Device is the device node for methods that need one (VA-API)
+	Device string `json:"device,omitempty"`
+
+	// Decode enables hardware decoding; when false only encoding and
+	// uploads use the hardware
+	Decode bool `json:"decode,omitempty"`
+}
+
+// JobMetadata is a metadata tag or disposition in a job spec. Stream is a
+// stream specifier such as "a:0", or empty for global metadata.
+type JobMetadata struct {
+	Stream string `json:"stream,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Value  string `json:"value"`
+}
+
+// JobSpec returns the job spec describing the command.
+func (c *Command) JobSpec() *JobSpec {
+	overwrite := c.overwrite
+	spec := &JobSpec{
+		Version:       JobSpecVersion,
+		Output:        c.outputPath,
+		Overwrite:     &overwrite,
+		VideoCodec:    c.videoCodec,
+		AudioCodec:    c.audioCodec,
+		SubtitleCodec: c.subtitleCodec,
+		CopyVideo:     c.copyVideo,
+		CopyAudio:     c.copyAudio,
+		NoVideo:       c.noVideo,
+		NoAudio:       c.noAudio,
+		VideoBitrate:  c.videoBitrate,
+		AudioBitrate:  c.audioBitrate,
+		Width:         c.width,
+		Height:        c.height,
+		FPS:           c.fps,
+		CRF:           c.crf,
+		Preset:        c.preset,
+		PixelFormat:   c.pixelFormat,
+		AudioRate:     c.audioRate,
+		Channels:      c.channels,
+		Duration:      c.duration,
+		StartTime:     c.startTime,
+		VideoFilter:   c.filterVideo,
+		AudioFilter:   c.filterAudio,
+		FilterComplex: c.filterComplex,
+		Maps:          slices.Clone(c.maps),
+		MapMetadata:   c.mapMetadata,
+		MapChapters:   c.mapChapters,
+		Args:          slices.Clone(c.extraArgs),
+		PresetArgs:    slices.Clone(c.presetArgs),
+
+		Threads:              c.threads,
+		FilterThreads:        c.filterThreads,
+		FilterComplexThreads: c.filterComplexThreads,
+		SoftwareFallback:     c.softwareFallback,
+
+		LogLevel:    c.logLevel,
+		HideBanner:  c.hideBanner,
+		Stats:       c.stats,
+		StderrLimit: c.stderrLimit,
+		GracePeriod: c.gracePeriod.Seconds(),
+
+		AtomicOutput: c.atomicOutput,
+
+		SkipValidation: c.skipValidation,
+	}
+
+	if c.hwaccel != nil {
+		spec.HWAccel = &JobHWAccel{
+			Method: c.hwaccel.method,
+			Device: c.hwaccel.device,
+			Decode: c.hwaccel.decode,
+		}
+	}
+
+	for _, in := range c.inputs {
+		spec.Inputs = append(spec.Inputs, JobInput{
+			Path:      in.path,
+			Format:    in.format,
+			FrameRate: in.frameRate,
+			Loop:      in.loop,
+			Duration:  in.duration,
+			StartTime: in.startTime,
+			Options:   slices.Clone(in.options),
+		})
+	}
+	for _, sub := range c.subtitles {
+		spec.Inputs[sub.input].Role = InputRoleSubtitle
+		spec.Inputs[sub.input].Language = sub.language
+	}
+	if c.coverArt != nil {
+		spec.Inputs[c.coverArt.input].Role = InputRoleCoverArt
+	}
+
+	for _, m := range c.metadata {
+		spec.Metadata = append(spec.Metadata, JobMetadata{Key: m.key, Value: m.value})
+	}
+	for _, m := range c.streamMeta {
+		spec.Metadata = append(spec.Metadata, JobMetadata{Stream: m.stream, Key: m.key, Value: m.value})
+	}
+	for _, d := range c.dispositions {
+		spec.Dispositions = append(spec.Dispositions, JobMetadata{Stream: d.stream, Value: d.value})
+	}
+	return spec
+}
+
+// Validate checks the job spec for unsupported versions and fields that
+// conflict with each other. All problems are returned as a joined error.
+func (s *JobSpec) Validate() error {
+	var errs []error
+	if s.Version != JobSpecVersion {
+		errs = append(errs, fmt.Errorf("unsupported job spec version %d (want %d)", s.Version, JobSpecVersion))
+	}
+	if s.CopyVideo && s.VideoCodec != "" {
+		errs = append(errs, errors.New("copyVideo conflicts with videoCodec"))
+	}
+	if s.CopyAudio && s.AudioCodec != "" {
+		errs = append(errs, errors.New("copyAudio conflicts with audioCodec"))
+	}
+
+	if s.HWAccel != nil {
+		switch s.HWAccel.Method {
+		case "cuda", "vaapi", "qsv", "videotoolbox":
+		default:
+			errs = append(errs, fmt.Errorf("hwaccel: unknown method %q", s.HWAccel.Method))
+		}
+		if s.VideoCodec == "" {
+			errs = append(errs, errors.New("hwaccel requires videoCodec"))
+		}
+	}
+
+	coverArts := 0
+	for i, in := range s.Inputs {
+		if in.Path == "" {
+			errs = append(errs, fmt.Errorf("inputs[%d]: path is required", i))
+		}
+		switch in.Role {
+		case "":
+		case InputRoleSubtitle:
+		case InputRoleCoverArt:
+			coverArts++
+		default:
+			errs = append(errs, fmt.Errorf("inputs[%d]: unknown role %q", i, in.Role))
+		}
+		if in.Language != "" && in.Role != InputRoleSubtitle {
+			errs = append(errs, fmt.Errorf("inputs[%d]: language is only valid for subtitle inputs", i))
+		}
+	}
+	if coverArts > 1 {
+		errs = append(errs, errors.New("only one coverArt input is allowed"))
+	}
+
+	for i, m := range s.Metadata {
+		if m.Key == "" {
+			errs = append(errs, fmt.Errorf("metadata[%d]: key is required", i))
+		}
+	}
+	for i, d := range s.Dispositions {
+		if d.Stream == "" {
+			errs = append(errs, fmt.Errorf("dispositions[%d]: stream is required", i))
+		}
+		if d.Key != "" {
+			errs = append(errs, fmt.Errorf("dispositions[%d]: key is not allowed", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Command validates the job spec and returns the command it describes.
+func (s *JobSpec) Command() (*Command, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := New()
+	if s.Overwrite != nil {
+		c.overwrite = *s.Overwrite
+	}
+	c.outputPath = s.Output
+	c.videoCodec = s.VideoCodec
+	c.audioCodec = s.AudioCodec
+	c.subtitleCodec = s.SubtitleCodec
+	c.copyVideo = s.CopyVideo
+	c.copyAudio = s.CopyAudio
+	c.noVideo = s.NoVideo
+	c.noAudio = s.NoAudio
+	c.videoBitrate = s.VideoBitrate
+	c.audioBitrate = s.AudioBitrate
+	c.width = s.Width
+	c.height = s.Height
+	c.fps = s.FPS
+	c.crf = s.CRF
+	c.preset = s.Preset
+	c.pixelFormat = s.PixelFormat
+	c.audioRate = s.AudioRate
+	c.channels = s.Channels
+	c.duration = s.Duration
+	c.startTime = s.StartTime
+	c.filterVideo = s.VideoFilter
+	c.filterAudio = s.AudioFilter
+	c.filterComplex = s.FilterComplex
+	c.maps = slices.Clone(s.Maps)
+	c.mapMetadata = s.MapMetadata
+	c.mapChapters = s.MapChapters
+	c.extraArgs = slices.Clone(s.Args)
+	c.presetArgs = slices.Clone(s.PresetArgs)
+	c.threads = s.Threads
+	c.filterThreads = s.FilterThreads
+	c.filterComplexThreads = s.FilterComplexThreads
+	c.softwareFallback = s.SoftwareFallback
+	c.logLevel = s.LogLevel
+	c.hideBanner = s.HideBanner
+	c.stats = s.Stats
+	c.stderrLimit = s.StderrLimit
+	c.gracePeriod = time.Duration(s.GracePeriod * float64(time.Second))
+	c.atomicOutput = s.AtomicOutput
+	if s.HWAccel != nil {
+		c.hwaccel = &hwPipeline{
+			method: s.HWAccel.Method,
+			device: s.HWAccel.Device,
+			decode: s.HWAccel.Decode,
+		}
+	}
+	c.skipValidation = s.SkipValidation
+
+	for i, in := range s.Inputs {
+		c.inputs = append(c.inputs, inputSpec{
+			path:      in.Path,
+			format:    in.Format,
+			frameRate: in.FrameRate,
+			loop:      in.Loop,
+			duration:  in.Duration,
+			startTime: in.StartTime,
+			options:   slices.Clone(in.Options),
+		})
+		switch in.Role {
+		case InputRoleSubtitle:
+			c.subtitles = append(c.subtitles, subtitleTrack{input: i, path: in.Path, language: in.Language})
+		case InputRoleCoverArt:
+			c.coverArt = &coverArt{input: i, path: in.Path}
+		}
+	}
+
+	for _, m := range s.Metadata {
+		if m.Stream == "" {
+			c.Metadata(m.Key, m.Value)
+		} else {
+			c.StreamMetadata(m.Stream, m.Key, m.Value)
+		}
+	}
+	for _, d := range s.Dispositions {
+		c.Disposition(d.Stream, d.Value)
+	}
+	return c, nil
+}
+
+// ParseJobSpec decodes a JSON job spec. Unknown fields are rejected and the
+// spec is validated.
+func ParseJobSpec(data []byte) (*JobSpec, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var spec JobSpec
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("failed to parse job spec: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("failed to parse job spec: unexpected data after spec")
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// MarshalJSON encodes the command as a JSON job spec.
+func (c *Command) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.JobSpec())
+}
+
+// UnmarshalJSON decodes a JSON job spec into the command, replacing its state.
+func (c *Command) UnmarshalJSON(data []byte) error {
+	spec, err := ParseJobSpec(data)
+	if err != nil {
+		return err
+	}
+	decoded, err := spec.Command()
+	if err != nil {
+		return err
+	}
+	*c = *decoded
+	return nil
+}
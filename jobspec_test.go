@@ -0,0 +1,134 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobSpecRoundTrip(t *testing.T) {
+	cmd := New().
+		InputWithStartTime("input.mp4", 5).
+		InputImage("logo.png", 25).
+		InputWithOptions("list.txt", "-f", "concat", "-safe", "0").
+		SubtitleTrack("en.srt", "eng").
+		CoverArt("cover.jpg").
+		ChapterFile("chapters.txt").
+		FilterComplex("[0:v][1:v]overlay[v]").
+		Map("[v]").
+		VideoCodec("libx264").
+		CRF(20).
+		Preset("slow").
+		Size(1280, 720).
+		CopyAudio().
+		Duration(30).
+		Threads(4).
+		FilterComplexThreads(2).
+		HideBanner().
+		LogLevel("error").
+		StderrLimit(4096).
+		GracePeriod(1500*time.Millisecond).
+		AtomicOutput().
+		Metadata("title", "Demo").
+		StreamMetadata("a:0", "language", "eng").
+		Disposition("a:0", "default").
+		Overwrite(false).
+		Args("-movflags", "+faststart").
+		Output("output.mp4")
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+
+	var decoded Command
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+
+	if got, want := decoded.Build(), cmd.Build(); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip Build() =\n%v\nwant\n%v", got, want)
+	}
+
+	if !reflect.DeepEqual(decoded.JobSpec(), cmd.JobSpec()) {
+		t.Errorf("round trip JobSpec() differs:\n%+v\n%+v", decoded.JobSpec(), cmd.JobSpec())
+	}
+}
+
+func TestJobSpecRoundTripPreset(t *testing.T) {
+	web, err := LookupPreset("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := web.Apply(New().Input("in.mov")).Args("-tune", "film").Output("out.mp4")
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	var decoded Command
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+
+	got := strings.Join(web.Apply(&decoded).Build(), " ")
+	if n := strings.Count(got, "-movflags"); n != 1 {
+		t.Errorf("applying a preset after a round trip gave %d -movflags in %s, want 1", n, got)
+	}
+	if want := strings.Join(web.Apply(cmd).Build(), " "); got != want {
+		t.Errorf("round trip Build() = %s, want %s", got, want)
+	}
+}
+
+func TestParseJobSpecUnknownField(t *testing.T) {
+	data := []byte(`{"version": 1, "inputs": [{"path": "in.mp4"}], "output": "out.mp4", "videoCodecs": "libx264"}`)
+	_, err := ParseJobSpec(data)
+	if err == nil || !strings.Contains(err.Error(), "videoCodecs") {
+		t.Errorf("ParseJobSpec() error = %v, want unknown field error", err)
+	}
+}
+
+func TestParseJobSpecConflicts(t *testing.T) {
+	data := []byte(`{
+		"version": 2,
+		"inputs": [{"path": "in.mp4", "role": "overlay"}, {"path": "a.jpg", "role": "coverArt"}, {"path": "b.jpg", "role": "coverArt"}],
+		"copyVideo": true,
+		"videoCodec": "libx264",
+		"metadata": [{"value": "x"}]
+	}`)
+	_, err := ParseJobSpec(data)
+	if err == nil {
+		t.Fatal("ParseJobSpec() should fail")
+	}
+
+	msg := err.Error()
+	wants := []string{
+		"unsupported job spec version 2",
+		"copyVideo conflicts with videoCodec",
+		`unknown role "overlay"`,
+		"only one coverArt input",
+		"metadata[0]: key is required",
+	}
+	for _, want := range wants {
+		if !strings.Contains(msg, want) {
+			t.Errorf("ParseJobSpec() error missing %q in:\n%s", want, msg)
+		}
+	}
+}
+
+func TestJobSpecDefaultOverwrite(t *testing.T) {
+	spec, err := ParseJobSpec([]byte(`{"version": 1, "inputs": [{"path": "in.mp4"}], "output": "out.mp4"}`))
+	if err != nil {
+		t.Fatalf("ParseJobSpec() error: %v", err)
+	}
+
+	cmd, err := spec.Command()
+	if err != nil {
+		t.Fatalf("Command() error: %v", err)
+	}
+	if args := cmd.Build(); args[0] != "-y" {
+		t.Errorf("Command() should overwrite by default, got %v", args)
+	}
+}
@@ -0,0 +1,142 @@
+package ffutil
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// GOPInfo summarizes the group-of-pictures structure of a video stream.
+type GOPInfo struct {
+	// Keyframes is the number of keyframes
+	Keyframes int `json:"keyframes"`
+
+	// MinLength is the shortest GOP in frames
+	MinLength int `json:"minLength"`
+
+	// MaxLength is the longest GOP in frames
+	MaxLength int `json:"maxLength"`
+
+	// AvgLength is the average GOP length in frames
+	AvgLength float64 `json:"avgLength"`
+
+	// MaxInterval is the longest time between keyframes
+	MaxInterval time.Duration `json:"maxInterval"`
+
+	// OpenGOP indicates if any GOP has frames that reference the previous GOP
+	OpenGOP bool `json:"openGop"`
+
+	// BFrames is the number of frames displayed before a frame decoded earlier
+	BFrames int `json:"bFrames"`
+}
+
+// Keyframes returns the keyframe timestamps of the first video stream,
+// in presentation order. Only keyframes are decoded (-skip_frame nokey),
+// so the timestamps are frames a decoder can start from even where packet
+// flags mark recovery points that are not.
+func Keyframes(ctx context.Context, path string) ([]time.Duration, error) {
+	args := []string{
+		"-v", "error", "-print_format", "json",
+		"-select_streams", "v:0", "-skip_frame", "nokey",
+		"-show_entries", "frame=pts_time,best_effort_timestamp_time", path,
+	}
+	var keyframes []time.Duration
+	for f, err := range probeSection[ffprobeFrame](ctx, args, "frames") {
+		if err != nil {
+			return nil, err
+		}
+		keyframes = append(keyframes, f.frame().PTS)
+	}
+	sort.Slice(keyframes, func(i, j int) bool { return keyframes[i] < keyframes[j] })
+	return keyframes, nil
+}
+
+// AnalyzeGOP returns a summary of the GOP structure of the first video stream.
+func AnalyzeGOP(ctx context.Context, path string) (*GOPInfo, error) {
+	var stats gopStats
+	for p, err := range Packets(ctx, path, FrameOptions{Stream: "v:0"}) {
+		if err != nil {
+			return nil, err
+		}
+		stats.add(p)
+	}
+	info := stats.result()
+	return &info, nil
+}
+
+// SnapToKeyframe returns the last keyframe at or before t, which is the
+// latest point a stream copy cut can start without losing frames.
+// It returns 0 if no keyframe precedes t.
+func SnapToKeyframe(keyframes []time.Duration, t time.Duration) time.Duration {
+	i := sort.Search(len(keyframes), func(i int) bool { return keyframes[i] > t })
+	if i == 0 {
+		return 0
+	}
+	return keyframes[i-1]
+}
+
+// gopStats accumulates GOP statistics from packets in decode order.
+type gopStats struct {
+	info      GOPInfo
+	total     int
+	length    int
+	keyPTS    time.Duration
+	maxPTS    time.Duration
+	seenFirst bool
+}
+
+func (s *gopStats) add(p Packet) {
+	if p.Key {
+		if s.info.Keyframes > 0 {
+			s.closeGOP(p.PTS)
+		}
+		s.info.Keyframes++
+		s.keyPTS = p.PTS
+		s.length = 0
+	} else if s.info.Keyframes > 0 && p.PTS < s.keyPTS {
+		// A frame displayed before its keyframe belongs to an open GOP.
+		s.info.OpenGOP = true
+	}
+
+	if s.seenFirst && p.PTS < s.maxPTS {
+		s.info.BFrames++
+	}
+	if !s.seenFirst || p.PTS > s.maxPTS {
+		s.maxPTS = p.PTS
+	}
+	s.seenFirst = true
+	s.length++
+}
+
+// closeGOP records the GOP ending before the keyframe at next.
+func (s *gopStats) closeGOP(next time.Duration) {
+	if s.info.MinLength == 0 || s.length < s.info.MinLength {
+		s.info.MinLength = s.length
+	}
+	if s.length > s.info.MaxLength {
+		s.info.MaxLength = s.length
+	}
+	if interval := next - s.keyPTS; interval > s.info.MaxInterval {
+		s.info.MaxInterval = interval
+	}
+	s.total += s.length
+}
+
+func (s *gopStats) result() GOPInfo {
+	info := s.info
+	if info.Keyframes == 0 {
+		return info
+	}
+	// Include the final GOP in the frame counts. It is usually cut short
+	// by the end of the stream, so it only counts toward the minimum if
+	// it is the only GOP.
+	total := s.total + s.length
+	if info.Keyframes == 1 {
+		info.MinLength = s.length
+	}
+	if s.length > info.MaxLength {
+		info.MaxLength = s.length
+	}
+	info.AvgLength = float64(total) / float64(info.Keyframes)
+	return info
+}
@@ -0,0 +1,120 @@
+package ffutil
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapToKeyframe(t *testing.T) {
+	keyframes := []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second}
+
+	tests := []struct {
+		t    time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{1500 * time.Millisecond, 0},
+		{2 * time.Second, 2 * time.Second},
+		{5900 * time.Millisecond, 4 * time.Second},
+		{10 * time.Second, 6 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := SnapToKeyframe(keyframes, tt.t); got != tt.want {
+			t.Errorf("SnapToKeyframe(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestGOPStats(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	// Decode order for I P B B P B B | I B B P with 100ms frames. The second
+	// GOP's B-frames are displayed before its keyframe, making it open.
+	packets := []Packet{
+		{PTS: ms(0), Key: true},
+		{PTS: ms(300)},
+		{PTS: ms(100)},
+		{PTS: ms(200)},
+		{PTS: ms(600)},
+		{PTS: ms(400)},
+		{PTS: ms(500)},
+		{PTS: ms(900), Key: true},
+		{PTS: ms(700)},
+		{PTS: ms(800)},
+		{PTS: ms(1000)},
+	}
+
+	var stats gopStats
+	for _, p := range packets {
+		stats.add(p)
+	}
+	info := stats.result()
+
+	if info.Keyframes != 2 {
+		t.Errorf("Keyframes = %d, want 2", info.Keyframes)
+	}
+	if info.MinLength != 7 || info.MaxLength != 7 {
+		t.Errorf("MinLength, MaxLength = %d, %d, want 7, 7", info.MinLength, info.MaxLength)
+	}
+	if info.AvgLength != 5.5 {
+		t.Errorf("AvgLength = %v, want 5.5", info.AvgLength)
+	}
+	if info.MaxInterval != ms(900) {
+		t.Errorf("MaxInterval = %v, want 900ms", info.MaxInterval)
+	}
+	if !info.OpenGOP {
+		t.Error("OpenGOP should be true")
+	}
+	if info.BFrames != 6 {
+		t.Errorf("BFrames = %d, want 6", info.BFrames)
+	}
+}
+
+func TestKeyframesNonExistentFile(t *testing.T) {
+	if !FFprobeAvailable() {
+		t.Skip("ffprobe not available")
+	}
+
+	if _, err := Keyframes(context.Background(), "/nonexistent/file.mp4"); err == nil {
+		t.Error("Keyframes() should return error for non-existent file")
+	}
+}
+
+func TestKeyframes(t *testing.T) {
+	fakeTool(t, "ffprobe", `case "$*" in
+*"-select_streams v:0 -skip_frame nokey -show_entries frame=pts_time"*) ;;
+*) echo "unexpected args: $*" >&2; exit 1 ;;
+esac
+echo '{"frames": [{"pts_time": "4.000000"}, {"pts_time": "0.000000"}, {"best_effort_timestamp_time": "2.000000"}]}'
+`)
+
+	got, err := Keyframes(context.Background(), "in.mp4")
+	if err != nil {
+		t.Fatalf("Keyframes() error: %v", err)
+	}
+	want := []time.Duration{0, 2 * time.Second, 4 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("Keyframes() = %v, want %v", got, want)
+	}
+}
+
+func TestAnalyzeGOPCanceled(t *testing.T) {
+	fakeTool(t, "ffprobe", `echo '{"packets": [{"pts_time": "0.000000", "flags": "K__"}]}'`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := AnalyzeGOP(ctx, "in.mp4"); err == nil {
+		t.Error("AnalyzeGOP() should fail with a canceled context")
+	}
+
+	info, err := AnalyzeGOP(context.Background(), "in.mp4")
+	if err != nil {
+		t.Fatalf("AnalyzeGOP() error: %v", err)
+	}
+	if info.Keyframes != 1 {
+		t.Errorf("Keyframes = %d, want 1", info.Keyframes)
+	}
+}
@@ -0,0 +1,242 @@
+package ffutil
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultStderrLimit is the number of bytes of ffmpeg stderr retained for
+// error messages unless StderrLimit is set.
+const DefaultStderrLimit = 64 << 10
+
+// logLevels are the ffmpeg log levels from least to most verbose.
+var logLevels = []string{"quiet", "panic", "fatal", "error", "warning", "info", "verbose", "debug", "trace"}
+
+// LogLevel sets the ffmpeg log level (-loglevel), such as "error",
+// "warning", "info" or "debug".
+func (c *Command) LogLevel(level string) *Command {
+	c.logLevel = level
+	return c
+}
+
+// HideBanner suppresses the ffmpeg version and configuration banner
+// (-hide_banner).
+func (c *Command) HideBanner() *Command {
+	c.hideBanner = true
+	return c
+}
+
+// Stats enables the periodic encoding statistics line ffmpeg writes to
+// stderr (-stats). Run disables it by default because progress is read
+// from "-progress" output instead.
+func (c *Command) Stats() *Command {
+	c.stats = true
+	return c
+}
+
+// Logger streams ffmpeg log lines to l while the command runs. Each line
+// is logged at the slog level matching its ffmpeg level, with the emitting
+// component (such as "libx264") as the "component" attribute. The ffmpeg
+// log level defaults to "info" when a logger is set.
+func (c *Command) Logger(l *slog.Logger) *Command {
+	c.logger = l
+	return c
+}
+
+// StderrLimit sets the number of bytes of stderr retained for the error
+// returned when ffmpeg fails. Older output is discarded so long runs use
+// bounded memory. With a Logger, longer lines are logged in pieces. The
+// default is DefaultStderrLimit.
+func (c *Command) StderrLimit(n int) *Command {
+	c.stderrLimit = n
+	return c
+}
+
+// logLevelArg returns the -loglevel value, adding the "level" flag so log
+// lines are prefixed with their level when a logger is set.
+func (c *Command) logLevelArg() string {
+	level := c.logLevel
+	if c.logger == nil {
+		return level
+	}
+	if level == "" {
+		level = "info"
+	}
+	if !slices.Contains(strings.Split(level, "+"), "level") {
+		level = "level+" + level
+	}
+	return level
+}
+
+// validLogLevel reports whether level is an ffmpeg log level name or
+// number, optionally prefixed by "repeat+" and "level+" flags.
+func validLogLevel(level string) bool {
+	parts := strings.Split(level, "+")
+	for _, flag := range parts[:len(parts)-1] {
+		if flag != "repeat" && flag != "level" && flag != "" {
+			return false
+		}
+	}
+	name := parts[len(parts)-1]
+	if _, err := strconv.Atoi(name); err == nil {
+		return true
+	}
+	return slices.Contains(logLevels, name)
+}
+
+// slogLevel maps an ffmpeg log level to a slog level.
+func slogLevel(level string) slog.Level {
+	switch level {
+	case "quiet", "panic", "fatal", "error":
+		return slog.LevelError
+	case "warning":
+		return slog.LevelWarn
+	case "verbose", "debug", "trace":
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// logLine is a parsed ffmpeg log line.
+type logLine struct {
+	level     string
+	component string
+	message   string
+}
+
+// parseLogLine parses a line printed with the "level" log flag, such as
+// "[libx264 @ 0x55d0c8e3a2c0] [info] using cpu capabilities". The component
+// is the innermost context name. Lines without a level prefix are
+// continuations and have an empty level.
+func parseLogLine(line string) logLine {
+	var l logLine
+	for strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "] ")
+		if end < 0 {
+			break
+		}
+		tag := line[1:end]
+		if name, _, ok := strings.Cut(tag, " @ "); ok {
+			l.component = name
+		} else if slices.Contains(logLevels, tag) {
+			l.level = tag
+		} else {
+			break
+		}
+		line = line[end+2:]
+	}
+	l.message = line
+	return l
+}
+
+// logWriter splits ffmpeg stderr into lines and logs them as they arrive.
+// Stats lines, which end in a carriage return, are logged like any other.
+// Lines longer than limit bytes (DefaultStderrLimit if limit is not
+// positive) are logged in pieces.
+type logWriter struct {
+	ctx     context.Context
+	logger  *slog.Logger
+	partial []byte
+	level   slog.Level
+	limit   int
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.log(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	// Log overlong lines in pieces so memory stays bounded.
+	limit := w.limit
+	if limit <= 0 {
+		limit = DefaultStderrLimit
+	}
+	if len(w.partial) > limit {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush logs any remaining partial line.
+func (w *logWriter) flush() {
+	if len(w.partial) > 0 {
+		w.log(string(w.partial))
+		w.partial = nil
+	}
+}
+
+func (w *logWriter) log(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	l := parseLogLine(line)
+	if l.level != "" {
+		w.level = slogLevel(l.level)
+	}
+	if l.component != "" {
+		w.logger.Log(w.ctx, w.level, l.message, slog.String("component", l.component))
+	} else {
+		w.logger.Log(w.ctx, w.level, l.message)
+	}
+}
+
+// ringBuffer retains the last limit bytes written to it.
+type ringBuffer struct {
+	data      []byte
+	limit     int
+	pos       int
+	truncated bool
+}
+
+func newRingBuffer(limit int) *ringBuffer {
+	if limit <= 0 {
+		limit = DefaultStderrLimit
+	}
+	return &ringBuffer{limit: limit}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(b.data) < b.limit {
+		// Grow until the limit is reached so short runs stay small.
+		room := min(b.limit-len(b.data), len(p))
+		b.data = append(b.data, p[:room]...)
+		p = p[room:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	b.truncated = true
+	if len(p) >= b.limit {
+		copy(b.data, p[len(p)-b.limit:])
+		b.pos = 0
+		return n, nil
+	}
+	written := copy(b.data[b.pos:], p)
+	copy(b.data, p[written:])
+	b.pos = (b.pos + len(p)) % b.limit
+	return n, nil
+}
+
+// String returns the retained output. When older output was discarded the
+// partial first line is dropped.
+func (b *ringBuffer) String() string {
+	if !b.truncated {
+		return string(b.data)
+	}
+	s := string(b.data[b.pos:]) + string(b.data[:b.pos])
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return "...\n" + s
+}
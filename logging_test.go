@@ -0,0 +1,200 @@
+package ffutil
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want logLine
+	}{
+		{
+			line: "[libx264 @ 0x55d0c8e3a2c0] [info] using cpu capabilities: MMX2 SSE2Fast",
+			want: logLine{level: "info", component: "libx264", message: "using cpu capabilities: MMX2 SSE2Fast"},
+		},
+		{
+			line: "[out#0/mp4 @ 0x1] [vost#0:0/libx264 @ 0x2] [warning] frame rate very high",
+			want: logLine{level: "warning", component: "vost#0:0/libx264", message: "frame rate very high"},
+		},
+		{
+			line: "[error] in.mp4: No such file or directory",
+			want: logLine{level: "error", message: "in.mp4: No such file or directory"},
+		},
+		{
+			line: "  Stream #0:0: Video: h264",
+			want: logLine{message: "  Stream #0:0: Video: h264"},
+		},
+		{
+			line: "[Parsed_scale_0] not a component",
+			want: logLine{message: "[Parsed_scale_0] not a component"},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseLogLine(tt.line); got != tt.want {
+			t.Errorf("parseLogLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestValidLogLevel(t *testing.T) {
+	tests := map[string]bool{
+		"info":              true,
+		"warning":           true,
+		"24":                true,
+		"level+debug":       true,
+		"repeat+level+info": true,
+		"+error":            true,
+		"loud":              false,
+		"color+info":        false,
+		"":                  false,
+	}
+	for level, want := range tests {
+		if got := validLogLevel(level); got != want {
+			t.Errorf("validLogLevel(%q) = %v, want %v", level, got, want)
+		}
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(16)
+	b.Write([]byte("line one\n"))
+	if got := b.String(); got != "line one\n" {
+		t.Errorf("String() = %q, want %q", got, "line one\n")
+	}
+
+	b.Write([]byte("line two\nline three\n"))
+	if got, want := b.String(), "...\nline three\n"; got != want {
+		t.Errorf("String() after wrap = %q, want %q", got, want)
+	}
+	if len(b.data) != 16 {
+		t.Errorf("len(data) = %d, want 16", len(b.data))
+	}
+
+	b.Write([]byte(strings.Repeat("x", 40) + "\nlast\n"))
+	if got, want := b.String(), "...\nlast\n"; got != want {
+		t.Errorf("String() after large write = %q, want %q", got, want)
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	w := &logWriter{ctx: context.Background(), logger: logger, level: slog.LevelInfo}
+	w.Write([]byte("[h264_nvenc @ 0x1] [error] No capable devices found\n  detail\n[info] frame=  10 fps=0.0\r[in"))
+	w.Write([]byte("fo] done"))
+	w.flush()
+
+	want := `level=ERROR msg="No capable devices found" component=h264_nvenc
+level=ERROR msg=detail
+level=INFO msg="frame=  10 fps=0.0"
+level=INFO msg=done
+`
+	if got := buf.String(); got != want {
+		t.Errorf("log output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLogWriterLimit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	w := &logWriter{ctx: context.Background(), logger: logger, level: slog.LevelInfo, limit: 8}
+	w.Write([]byte("0123456789"))
+	w.Write([]byte("abc\n"))
+	w.flush()
+
+	want := "level=INFO msg=0123456789\nlevel=INFO msg=abc\n"
+	if got := buf.String(); got != want {
+		t.Errorf("log output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunLogger(t *testing.T) {
+	fakeFFmpeg(t, `case "$*" in
+*"-loglevel level+info"*) ;;
+*) echo "missing level flag: $*" >&2; exit 1 ;;
+esac
+echo "[libx264 @ 0x1] [warning] deprecated pixel format" >&2
+i=0
+while [ $i -lt 200 ]; do echo "[info] filler line $i" >&2; i=$((i+1)); done
+echo "[error] conversion failed" >&2
+exit 1
+`)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	err := New().
+		Input("in.mp4").
+		Logger(logger).
+		StderrLimit(256).
+		Output(filepath.Join(t.TempDir(), "out.mp4")).
+		Run(context.Background())
+	if err == nil {
+		t.Fatal("Run() should fail")
+	}
+	if !strings.Contains(buf.String(), `level=WARN msg="deprecated pixel format" component=libx264`) {
+		t.Errorf("log output missing warning:\n%s", buf.String())
+	}
+	if strings.Count(buf.String(), "filler line") != 200 {
+		t.Errorf("log output should contain every line")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "conversion failed") || strings.Contains(msg, "deprecated pixel format") {
+		t.Errorf("error should keep only the stderr tail, got:\n%s", msg)
+	}
+	if len(msg) > 512 {
+		t.Errorf("len(error) = %d, want the stderr limit to bound it", len(msg))
+	}
+}
+
+func TestRunWithOutputLogger(t *testing.T) {
+	fakeFFmpeg(t, `echo "[libx264 @ 0x1] [warning] deprecated pixel format" >&2
+i=0
+while [ $i -lt 200 ]; do echo "[info] filler line $i" >&2; i=$((i+1)); done
+echo "[error] conversion failed" >&2
+exit 1
+`)
+
+	var buf bytes.Buffer
+	output, err := New().
+		Input("in.mp4").
+		Logger(slog.New(slog.NewTextHandler(&buf, nil))).
+		StderrLimit(256).
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(context.Background())
+	if err == nil {
+		t.Fatal("RunWithOutput() should fail")
+	}
+	if !strings.Contains(buf.String(), `level=WARN msg="deprecated pixel format" component=libx264`) {
+		t.Errorf("log output missing warning:\n%s", buf.String())
+	}
+	if msg := err.Error(); len(msg) > 512 || !strings.Contains(msg, "conversion failed") {
+		t.Errorf("error should hold only the stderr tail, got %d bytes:\n%s", len(msg), msg)
+	}
+	if strings.Count(string(output), "filler line") != 200 {
+		t.Error("RunWithOutput() should return the full output")
+	}
+}
@@ -0,0 +1,118 @@
+package ffutil
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MetadataChanges describes tag and disposition edits for EditMetadata.
+// An empty tag value removes the tag.
+type MetadataChanges struct {
+	// Global contains container-level tag changes
+	Global map[string]string
+
+	// Streams contains per-stream tag changes keyed by stream specifier
+	// (e.g., "a:0")
+	Streams map[string]map[string]string
+
+	// Dispositions contains disposition changes keyed by stream specifier
+	// (e.g., {"a:1": "default"})
+	Dispositions map[string]string
+
+	// Strip removes all existing tags, global and per-stream, before
+	// applying Global and Streams
+	Strip bool
+}
+
+// EditMetadata rewrites the tags of a media file in place. Streams are
+// copied without re-encoding into a temporary file in the same directory,
+// which then replaces the original.
+func EditMetadata(ctx context.Context, path string, changes MetadataChanges) error {
+	tmp, err := tempOutputPath(path)
+	if err != nil {
+		return err
+	}
+
+	cmd := editMetadataCommand(path, tmp, changes)
+	if err := cmd.Run(ctx); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// editMetadataCommand builds a stream copy command applying the changes.
+// Map keys are applied in sorted order so the arguments are stable.
+func editMetadataCommand(input, output string, changes MetadataChanges) *Command {
+	cmd := New().
+		Input(input).
+		Map("0").
+		Args("-c", "copy").
+		Output(output)
+
+	if changes.Strip {
+		cmd.StripMetadata()
+	}
+	for _, key := range sortedKeys(changes.Global) {
+		cmd.Metadata(key, changes.Global[key])
+	}
+	for _, stream := range sortedKeys(changes.Streams) {
+		tags := changes.Streams[stream]
+		for _, key := range sortedKeys(tags) {
+			cmd.StreamMetadata(stream, key, tags[key])
+		}
+	}
+	for _, stream := range sortedKeys(changes.Dispositions) {
+		cmd.Disposition(stream, changes.Dispositions[stream])
+	}
+	return cmd
+}
+
+// tempOutputPath creates an empty temporary file next to path with the same
+// extension, so ffmpeg infers the same muxer, and returns its name. The file
+// has the mode of an existing file at path, or the default mode for new
+// files (0666 less the umask), so renaming it into place does not change
+// the output's permissions.
+func tempOutputPath(path string) (string, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	ext := filepath.Ext(base)
+	prefix := filepath.Join(dir, "."+base[:len(base)-len(ext)]+".")
+	for range 100 {
+		name := prefix + rand.Text() + ".tmp" + ext
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666) //nolint:gosec // outputs get the default file mode
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create temp file: %w", err)
+		}
+		f.Close()
+		if fi, err := os.Stat(path); err == nil {
+			if err := os.Chmod(name, fi.Mode().Perm()); err != nil {
+				os.Remove(name)
+				return "", fmt.Errorf("failed to create temp file: %w", err)
+			}
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("failed to create temp file next to %s", path)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEditMetadataCommand(t *testing.T) {
+	changes := MetadataChanges{
+		Global: map[string]string{"comment": ""},
+		Streams: map[string]map[string]string{
+			"a:0": {"language": "eng"},
+		},
+		Dispositions: map[string]string{"a:1": "default"},
+		Strip:        true,
+	}
+
+	args := strings.Join(editMetadataCommand("in.mp4", "tmp.mp4", changes).Build(), " ")
+	want := "-y -i in.mp4 -map 0 -map_metadata -1 -metadata comment= " +
+		"-metadata:s:a:0 language=eng -disposition:a:1 default -c copy tmp.mp4"
+	if args != want {
+		t.Errorf("editMetadataCommand() =\n%s\nwant\n%s", args, want)
+	}
+}
+
+func TestTempOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	tmp, err := tempOutputPath(filepath.Join(dir, "video.mp4"))
+	if err != nil {
+		t.Fatalf("tempOutputPath() error: %v", err)
+	}
+	defer os.Remove(tmp)
+
+	if filepath.Dir(tmp) != dir {
+		t.Errorf("tempOutputPath() dir = %s, want %s", filepath.Dir(tmp), dir)
+	}
+	if filepath.Ext(tmp) != ".mp4" {
+		t.Errorf("tempOutputPath() should keep extension, got %s", tmp)
+	}
+}
+
+func TestTempOutputPathMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	dir := t.TempDir()
+
+	// A new output gets the default file mode.
+	newPath := filepath.Join(dir, "new.mp4")
+	if err := os.WriteFile(newPath, nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.Stat(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(newPath)
+	assertTempMode(t, newPath, want.Mode().Perm())
+
+	// An existing output keeps its mode.
+	existing := filepath.Join(dir, "existing.mp4")
+	if err := os.WriteFile(existing, nil, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(existing, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	assertTempMode(t, existing, 0o640)
+}
+
+func assertTempMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	tmp, err := tempOutputPath(path)
+	if err != nil {
+		t.Fatalf("tempOutputPath() error: %v", err)
+	}
+	defer os.Remove(tmp)
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != want {
+		t.Errorf("tempOutputPath(%s) mode = %v, want %v", filepath.Base(path), got, want)
+	}
+}
+
+func TestStreamInfo(t *testing.T) {
+	data := `{"index": 2, "codec_type": "audio", "codec_name": "aac",
+	  "tags": {"language": "fra"}, "disposition": {"default": 0, "dub": 1, "forced": 0}}`
+	var raw ffprobeStream
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	info := raw.streamInfo()
+	if info.Index != 2 || info.Type != "audio" || info.Tags["language"] != "fra" {
+		t.Errorf("streamInfo() = %+v", info)
+	}
+	if !info.HasDisposition("dub") || info.HasDisposition("default") {
+		t.Errorf("streamInfo().Disposition = %v, want [dub]", info.Disposition)
+	}
+}
@@ -0,0 +1,382 @@
+package ffutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Preset is a named, reusable set of encoding settings.
+// Zero-valued and nil fields are left unset when the preset is applied.
+type Preset struct {
+	// Name identifies the preset (e.g., "web")
+	Name string `json:"name" yaml:"name"`
+
+	// Description is a human-readable summary
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Extends names a registered preset whose settings this preset overrides
+	Extends string `json:"extends,omitempty" yaml:"extends,omitempty"`
+
+	// Extension is the recommended output file extension (e.g., ".mp4")
+	Extension string `json:"extension,omitempty" yaml:"extension,omitempty"`
+
+	VideoCodec    string   `json:"videoCodec,omitempty" yaml:"videoCodec,omitempty"`
+	AudioCodec    string   `json:"audioCodec,omitempty" yaml:"audioCodec,omitempty"`
+	VideoBitrate  string   `json:"videoBitrate,omitempty" yaml:"videoBitrate,omitempty"`
+	AudioBitrate  string   `json:"audioBitrate,omitempty" yaml:"audioBitrate,omitempty"`
+	CRF           int      `json:"crf,omitempty" yaml:"crf,omitempty"`
+	EncoderPreset string   `json:"preset,omitempty" yaml:"preset,omitempty"`
+	PixelFormat   string   `json:"pixelFormat,omitempty" yaml:"pixelFormat,omitempty"`
+	Width         int      `json:"width,omitempty" yaml:"width,omitempty"`
+	Height        int      `json:"height,omitempty" yaml:"height,omitempty"`
+	FPS           int      `json:"fps,omitempty" yaml:"fps,omitempty"`
+	AudioRate     int      `json:"audioRate,omitempty" yaml:"audioRate,omitempty"`
+	Channels      int      `json:"channels,omitempty" yaml:"channels,omitempty"`
+	NoVideo       *bool    `json:"noVideo,omitempty" yaml:"noVideo,omitempty"`
+	NoAudio       *bool    `json:"noAudio,omitempty" yaml:"noAudio,omitempty"`
+	VideoFilter   string   `json:"videoFilter,omitempty" yaml:"videoFilter,omitempty"`
+	AudioFilter   string   `json:"audioFilter,omitempty" yaml:"audioFilter,omitempty"`
+	Args          []string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// BuiltinPresets are the presets registered by default.
+var BuiltinPresets = []Preset{
+	{
+		Name:          "web",
+		Description:   "H.264/AAC MP4 for progressive web playback",
+		Extension:     ".mp4",
+		VideoCodec:    "libx264",
+		CRF:           23,
+		EncoderPreset: "medium",
+		PixelFormat:   "yuv420p",
+		AudioCodec:    "aac",
+		AudioBitrate:  "128k",
+		Args:          []string{"-movflags", "+faststart"},
+	},
+	{
+		Name:          "youtube",
+		Description:   "High quality H.264/AAC MP4 for YouTube upload",
+		Extends:       "web",
+		CRF:           18,
+		EncoderPreset: "slow",
+		AudioBitrate:  "384k",
+		AudioRate:     48000,
+		Args:          []string{"-movflags", "+faststart", "-bf", "2"},
+	},
+	{
+		Name:        "prores",
+		Description: "Apple ProRes 422 HQ mezzanine",
+		Extension:   ".mov",
+		VideoCodec:  "prores_ks",
+		PixelFormat: "yuv422p10le",
+		AudioCodec:  "pcm_s16le",
+		AudioRate:   48000,
+		Args:        []string{"-profile:v", "3", "-vendor", "apl0"},
+	},
+	{
+		Name:         "webm-vp9",
+		Description:  "VP9/Opus WebM with constant quality",
+		Extension:    ".webm",
+		VideoCodec:   "libvpx-vp9",
+		CRF:          31,
+		VideoBitrate: "0",
+		PixelFormat:  "yuv420p",
+		AudioCodec:   "libopus",
+		AudioBitrate: "128k",
+		Args:         []string{"-row-mt", "1"},
+	},
+	{
+		Name:         "podcast-mp3",
+		Description:  "Stereo MP3 for podcast distribution",
+		Extension:    ".mp3",
+		NoVideo:      Bool(true),
+		AudioCodec:   "libmp3lame",
+		AudioBitrate: "128k",
+		AudioRate:    44100,
+		Channels:     2,
+	},
+	{
+		Name:         "opus-voice",
+		Description:  "Low bitrate mono Opus for speech",
+		Extension:    ".opus",
+		NoVideo:      Bool(true),
+		AudioCodec:   "libopus",
+		AudioBitrate: "32k",
+		AudioRate:    48000,
+		Channels:     1,
+		Args:         []string{"-application", "voip"},
+	},
+	{
+		Name:        "gif",
+		Description: "Animated GIF with a generated palette",
+		Extension:   ".gif",
+		NoAudio:     Bool(true),
+		VideoFilter: "fps=10,scale=480:-1:flags=lanczos,split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse",
+		Args:        []string{"-loop", "0"},
+	},
+}
+
+// Bool returns a pointer to v, for setting Preset.NoVideo and
+// Preset.NoAudio.
+func Bool(v bool) *bool {
+	return &v
+}
+
+var (
+	presetsMu sync.RWMutex
+	presets   = map[string]Preset{}
+)
+
+func init() {
+	for _, p := range BuiltinPresets {
+		presets[p.Name] = p
+	}
+}
+
+// RegisterPreset adds or replaces a preset in the registry.
+func RegisterPreset(p Preset) error {
+	if p.Name == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	presets[p.Name] = p
+	return nil
+}
+
+// PresetNames returns the names of all registered presets in sorted order.
+func PresetNames() []string {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupPreset returns a copy of the registered preset with the given name,
+// with any Extends chain resolved into a single preset.
+func LookupPreset(name string) (Preset, error) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	return resolvePreset(name, nil)
+}
+
+func resolvePreset(name string, seen []string) (Preset, error) {
+	if slices.Contains(seen, name) {
+		return Preset{}, fmt.Errorf("preset %q extends itself", name)
+	}
+	p, ok := presets[name]
+	if !ok {
+		return Preset{}, fmt.Errorf("unknown preset %q", name)
+	}
+	if p.Extends == "" {
+		return p.clone(), nil
+	}
+	base, err := resolvePreset(p.Extends, append(seen, name))
+	if err != nil {
+		return Preset{}, err
+	}
+	resolved := base.With(p)
+	resolved.Extends = ""
+	return resolved, nil
+}
+
+// clone returns a copy of p that shares no memory with p, so callers can
+// modify presets returned from the registry.
+func (p Preset) clone() Preset {
+	p.Args = slices.Clone(p.Args)
+	if p.NoVideo != nil {
+		p.NoVideo = Bool(*p.NoVideo)
+	}
+	if p.NoAudio != nil {
+		p.NoAudio = Bool(*p.NoAudio)
+	}
+	return p
+}
+
+// With returns a copy of p with every non-zero and non-nil field of
+// override applied, so an override can turn NoVideo or NoAudio off by
+// setting it to Bool(false).
+func (p Preset) With(override Preset) Preset {
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(dst *int, v int) {
+		if v != 0 {
+			*dst = v
+		}
+	}
+
+	setString(&p.Name, override.Name)
+	setString(&p.Description, override.Description)
+	setString(&p.Extends, override.Extends)
+	setString(&p.Extension, override.Extension)
+	setString(&p.VideoCodec, override.VideoCodec)
+	setString(&p.AudioCodec, override.AudioCodec)
+	setString(&p.VideoBitrate, override.VideoBitrate)
+	setString(&p.AudioBitrate, override.AudioBitrate)
+	setInt(&p.CRF, override.CRF)
+	setString(&p.EncoderPreset, override.EncoderPreset)
+	setString(&p.PixelFormat, override.PixelFormat)
+	setInt(&p.Width, override.Width)
+	setInt(&p.Height, override.Height)
+	setInt(&p.FPS, override.FPS)
+	setInt(&p.AudioRate, override.AudioRate)
+	setInt(&p.Channels, override.Channels)
+	if override.NoVideo != nil {
+		p.NoVideo = Bool(*override.NoVideo)
+	}
+	if override.NoAudio != nil {
+		p.NoAudio = Bool(*override.NoAudio)
+	}
+	setString(&p.VideoFilter, override.VideoFilter)
+	setString(&p.AudioFilter, override.AudioFilter)
+	if override.Args != nil {
+		p.Args = slices.Clone(override.Args)
+	}
+	return p
+}
+
+// Apply sets the preset's encoding settings on the command.
+// Settings applied to the command afterwards take precedence. Args replace
+// those of a previously applied preset, so applying a preset again does not
+// repeat them.
+func (p Preset) Apply(c *Command) *Command {
+	if p.NoVideo != nil {
+		c.noVideo = *p.NoVideo
+	}
+	if p.NoAudio != nil {
+		c.noAudio = *p.NoAudio
+	}
+	if p.VideoCodec != "" {
+		c.VideoCodec(p.VideoCodec)
+	}
+	if p.AudioCodec != "" {
+		c.AudioCodec(p.AudioCodec)
+	}
+	if p.VideoBitrate != "" {
+		c.VideoBitrate(p.VideoBitrate)
+	}
+	if p.AudioBitrate != "" {
+		c.AudioBitrate(p.AudioBitrate)
+	}
+	if p.CRF > 0 {
+		c.CRF(p.CRF)
+	}
+	if p.EncoderPreset != "" {
+		c.Preset(p.EncoderPreset)
+	}
+	if p.PixelFormat != "" {
+		c.PixelFormat(p.PixelFormat)
+	}
+	if p.Width > 0 || p.Height > 0 {
+		c.Size(p.Width, p.Height)
+	}
+	if p.FPS > 0 {
+		c.FPS(p.FPS)
+	}
+	if p.AudioRate > 0 {
+		c.AudioRate(p.AudioRate)
+	}
+	if p.Channels > 0 {
+		c.Channels(p.Channels)
+	}
+	if p.VideoFilter != "" {
+		c.VideoFilter(p.VideoFilter)
+	}
+	if p.AudioFilter != "" {
+		c.AudioFilter(p.AudioFilter)
+	}
+	if p.Args != nil {
+		c.presetArgs = slices.Clone(p.Args)
+	}
+	return c
+}
+
+// ApplyPreset applies the registered preset with the given name.
+// Unknown presets are reported by returning an error.
+func (c *Command) ApplyPreset(name string) (*Command, error) {
+	p, err := LookupPreset(name)
+	if err != nil {
+		return c, err
+	}
+	return p.Apply(c), nil
+}
+
+// ParsePresets decodes a list of presets from JSON or YAML.
+// The format is "json" or "yaml".
+func ParsePresets(data []byte, format string) ([]Preset, error) {
+	var list []Preset
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &list)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &list)
+	default:
+		return nil, fmt.Errorf("unsupported preset format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse presets: %w", err)
+	}
+	return list, nil
+}
+
+// LoadPresets reads presets from a .json, .yaml or .yml file and registers them.
+func LoadPresets(path string) ([]Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list, err := ParsePresets(data, presetFormat(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if err := RegisterPreset(p); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// SavePresets writes presets to a .json, .yaml or .yml file.
+func SavePresets(path string, list []Preset) error {
+	var data []byte
+	var err error
+	switch presetFormat(path) {
+	case "json":
+		data, err = json.MarshalIndent(list, "", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(list)
+	default:
+		return fmt.Errorf("unsupported preset file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func presetFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return ""
+}
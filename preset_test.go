@@ -0,0 +1,215 @@
+package ffutil
+
+import (
+	"maps"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupPresetExtends(t *testing.T) {
+	p, err := LookupPreset("youtube")
+	if err != nil {
+		t.Fatalf("LookupPreset() error: %v", err)
+	}
+
+	if p.VideoCodec != "libx264" || p.Extension != ".mp4" {
+		t.Errorf("youtube should inherit codec and extension from web, got %+v", p)
+	}
+	if p.CRF != 18 || p.EncoderPreset != "slow" {
+		t.Errorf("youtube should override CRF and preset, got %+v", p)
+	}
+	if p.Extends != "" {
+		t.Errorf("resolved preset should not extend, got %q", p.Extends)
+	}
+}
+
+func TestLookupPresetCopiesArgs(t *testing.T) {
+	p, err := LookupPreset("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Args[0] = "-changed"
+
+	p, err = LookupPreset("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Args[0] != "-movflags" {
+		t.Errorf("editing a looked up preset changed the registry: Args = %v", p.Args)
+	}
+
+	mp3, err := LookupPreset("podcast-mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*mp3.NoVideo = false
+	if mp3, _ = LookupPreset("podcast-mp3"); !*mp3.NoVideo {
+		t.Error("editing a looked up preset changed the registered NoVideo")
+	}
+}
+
+func TestLookupPresetErrors(t *testing.T) {
+	if _, err := LookupPreset("nonexistent"); err == nil {
+		t.Error("LookupPreset() should fail for unknown preset")
+	}
+
+	restorePresets(t)
+	if err := RegisterPreset(Preset{Name: "loop-a", Extends: "loop-b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPreset(Preset{Name: "loop-b", Extends: "loop-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupPreset("loop-a"); err == nil {
+		t.Error("LookupPreset() should fail for cyclic presets")
+	}
+}
+
+func TestPresetApply(t *testing.T) {
+	p, err := LookupPreset("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = p.With(Preset{CRF: 20, Width: 1280, Height: 720})
+
+	args := strings.Join(p.Apply(New().Input("in.mov")).Output("out.mp4").Build(), " ")
+	wants := []string{"-c:v libx264", "-crf 20", "-preset medium", "-s 1280x720", "-c:a aac", "-movflags +faststart"}
+	for _, want := range wants {
+		if !strings.Contains(args, want) {
+			t.Errorf("Apply() missing %q in %s", want, args)
+		}
+	}
+}
+
+func TestPresetApplyTwice(t *testing.T) {
+	web, err := LookupPreset("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	youtube, err := LookupPreset("youtube")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := web.Apply(web.Apply(New().Input("in.mov")))
+	args := strings.Join(cmd.Args("-tune", "film").Output("out.mp4").Build(), " ")
+	if n := strings.Count(args, "-movflags"); n != 1 {
+		t.Errorf("applying a preset twice gave %d -movflags in %s, want 1", n, args)
+	}
+
+	args = strings.Join(youtube.Apply(cmd).Build(), " ")
+	if !strings.Contains(args, "-movflags +faststart -bf 2 -tune film out.mp4") {
+		t.Errorf("Apply() should replace the previous preset's args, got %s", args)
+	}
+}
+
+func TestPresetWithBools(t *testing.T) {
+	base := Preset{NoVideo: Bool(true)}
+	tests := []struct {
+		name     string
+		override Preset
+		want     bool
+	}{
+		{"unset keeps base", Preset{}, true},
+		{"explicit false", Preset{NoVideo: Bool(false)}, false},
+		{"explicit true", Preset{NoVideo: Bool(true)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := base.With(tt.override)
+			if p.NoVideo == nil || *p.NoVideo != tt.want {
+				t.Errorf("With() NoVideo = %v, want %v", p.NoVideo, tt.want)
+			}
+		})
+	}
+
+	restorePresets(t)
+	if err := RegisterPreset(Preset{Name: "podcast-video", Extends: "podcast-mp3", NoVideo: Bool(false), VideoCodec: "libx264"}); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := New().Input("in.mp4").NoVideo().ApplyPreset("podcast-video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := strings.Join(cmd.Output("out.mp4").Build(), " "); strings.Contains(args, "-vn") {
+		t.Errorf("preset with NoVideo false should keep video, got %s", args)
+	}
+}
+
+func TestApplyPresetAudioOnly(t *testing.T) {
+	cmd, err := New().Input("in.wav").ApplyPreset("podcast-mp3")
+	if err != nil {
+		t.Fatalf("ApplyPreset() error: %v", err)
+	}
+
+	args := strings.Join(cmd.Output("out.mp3").Build(), " ")
+	if !strings.Contains(args, "-vn") || !strings.Contains(args, "-c:a libmp3lame") {
+		t.Errorf("ApplyPreset() args = %s", args)
+	}
+}
+
+func TestParsePresets(t *testing.T) {
+	yamlData := []byte(`
+- name: team-h264
+  extends: web
+  crf: 21
+  args: ["-tune", "film"]
+`)
+	list, err := ParsePresets(yamlData, "yaml")
+	if err != nil {
+		t.Fatalf("ParsePresets() error: %v", err)
+	}
+
+	want := Preset{Name: "team-h264", Extends: "web", CRF: 21, Args: []string{"-tune", "film"}}
+	if len(list) != 1 || !reflect.DeepEqual(list[0], want) {
+		t.Errorf("ParsePresets() = %+v, want %+v", list, want)
+	}
+
+	if _, err := ParsePresets(yamlData, "toml"); err == nil {
+		t.Error("ParsePresets() should fail for unsupported format")
+	}
+}
+
+func TestSaveLoadPresets(t *testing.T) {
+	restorePresets(t)
+	list := []Preset{{Name: "saved-vp9", Extends: "webm-vp9", CRF: 28}}
+
+	for _, ext := range []string{".json", ".yaml"} {
+		path := filepath.Join(t.TempDir(), "presets"+ext)
+		if err := SavePresets(path, list); err != nil {
+			t.Fatalf("SavePresets(%s) error: %v", ext, err)
+		}
+
+		loaded, err := LoadPresets(path)
+		if err != nil {
+			t.Fatalf("LoadPresets(%s) error: %v", ext, err)
+		}
+		if !reflect.DeepEqual(loaded, list) {
+			t.Errorf("LoadPresets(%s) = %+v, want %+v", ext, loaded, list)
+		}
+	}
+
+	p, err := LookupPreset("saved-vp9")
+	if err != nil {
+		t.Fatalf("loaded preset should be registered: %v", err)
+	}
+	if p.VideoCodec != "libvpx-vp9" || p.CRF != 28 {
+		t.Errorf("LookupPreset(saved-vp9) = %+v", p)
+	}
+}
+
+// restorePresets restores the preset registry when the test finishes, so
+// presets registered by the test do not leak into other tests.
+func restorePresets(t *testing.T) {
+	t.Helper()
+	presetsMu.RLock()
+	saved := maps.Clone(presets)
+	presetsMu.RUnlock()
+	t.Cleanup(func() {
+		presetsMu.Lock()
+		presets = saved
+		presetsMu.Unlock()
+	})
+}
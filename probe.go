@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +32,9 @@ type MediaInfo struct {
 	// VideoCodec is the video codec name (empty if no video)
 	VideoCodec string `json:"videoCodec,omitempty"`
 
+	// FrameRate is the average video frame rate in frames per second (0 if no video)
+	FrameRate float64 `json:"frameRate,omitempty"`
+
 	// AudioCodec is the audio codec name (empty if no audio)
 	AudioCodec string `json:"audioCodec,omitempty"`
 
@@ -47,28 +52,85 @@ type MediaInfo struct {
 
 	// HasAudio indicates if the file has an audio stream
 	HasAudio bool `json:"hasAudio"`
+
+	// Chapters lists the chapter markers in start time order
+	Chapters []Chapter `json:"chapters,omitempty"`
+
+	// Tags contains the container-level metadata tags
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Streams lists every stream in the file
+	Streams []StreamInfo `json:"streams,omitempty"`
+}
+
+// StreamInfo contains information about a single stream.
+type StreamInfo struct {
+	// Index is the stream index within the file
+	Index int `json:"index"`
+
+	// Type is the stream type ("video", "audio", "subtitle", "data")
+	Type string `json:"type"`
+
+	// Codec is the codec name
+	Codec string `json:"codec"`
+
+	// Tags contains the stream metadata tags (e.g., "language", "title")
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Disposition lists the disposition flags that are set (e.g., "default")
+	Disposition []string `json:"disposition,omitempty"`
 }
 
 // ffprobeOutput represents the JSON output from ffprobe
 type ffprobeOutput struct {
-	Format  ffprobeFormat   `json:"format"`
-	Streams []ffprobeStream `json:"streams"`
+	Format   ffprobeFormat    `json:"format"`
+	Streams  []ffprobeStream  `json:"streams"`
+	Chapters []ffprobeChapter `json:"chapters"`
 }
 
 type ffprobeFormat struct {
-	Filename   string `json:"filename"`
-	FormatName string `json:"format_name"`
-	Duration   string `json:"duration"`
-	BitRate    string `json:"bit_rate"`
+	Filename   string            `json:"filename"`
+	FormatName string            `json:"format_name"`
+	Duration   string            `json:"duration"`
+	BitRate    string            `json:"bit_rate"`
+	Tags       map[string]string `json:"tags,omitempty"`
 }
 
 type ffprobeStream struct {
+	Index      int    `json:"index"`
 	CodecType  string `json:"codec_type"`
 	CodecName  string `json:"codec_name"`
 	Width      int    `json:"width,omitempty"`
 	Height     int    `json:"height,omitempty"`
 	SampleRate string `json:"sample_rate,omitempty"`
 	Channels   int    `json:"channels,omitempty"`
+
+	AvgFrameRate string `json:"avg_frame_rate,omitempty"`
+	RFrameRate   string `json:"r_frame_rate,omitempty"`
+
+	Tags        map[string]string `json:"tags,omitempty"`
+	Disposition map[string]int    `json:"disposition,omitempty"`
+}
+
+func (s ffprobeStream) streamInfo() StreamInfo {
+	info := StreamInfo{
+		Index: s.Index,
+		Type:  s.CodecType,
+		Codec: s.CodecName,
+		Tags:  s.Tags,
+	}
+	for name, set := range s.Disposition {
+		if set != 0 {
+			info.Disposition = append(info.Disposition, name)
+		}
+	}
+	sort.Strings(info.Disposition)
+	return info
+}
+
+// HasDisposition reports whether the named disposition flag is set.
+func (s StreamInfo) HasDisposition(name string) bool {
+	return slices.Contains(s.Disposition, name)
 }
 
 // Probe returns detailed information about a media file.
@@ -78,6 +140,7 @@ func Probe(path string) (*MediaInfo, error) {
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
+		"-show_chapters",
 		path,
 	}
 
@@ -98,6 +161,7 @@ func Probe(path string) (*MediaInfo, error) {
 	info := &MediaInfo{
 		Path:   path,
 		Format: output.Format.FormatName,
+		Tags:   output.Format.Tags,
 	}
 
 	// Parse duration
@@ -116,12 +180,17 @@ func Probe(path string) (*MediaInfo, error) {
 
 	// Process streams
 	for _, stream := range output.Streams {
+		info.Streams = append(info.Streams, stream.streamInfo())
 		switch stream.CodecType {
 		case "video":
 			info.HasVideo = true
 			info.VideoCodec = stream.CodecName
 			info.Width = stream.Width
 			info.Height = stream.Height
+			info.FrameRate = parseRational(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseRational(stream.RFrameRate)
+			}
 		case "audio":
 			info.HasAudio = true
 			info.AudioCodec = stream.CodecName
@@ -134,9 +203,32 @@ func Probe(path string) (*MediaInfo, error) {
 		}
 	}
 
+	for _, ch := range output.Chapters {
+		info.Chapters = append(info.Chapters, ch.chapter())
+	}
+	sort.SliceStable(info.Chapters, func(i, j int) bool {
+		return info.Chapters[i].Start < info.Chapters[j].Start
+	})
+
 	return info, nil
 }
 
+// parseRational parses an ffprobe rational such as "30000/1001".
+// It returns 0 for unknown or invalid values like "0/0".
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
 // Duration returns the duration of a media file.
 // This is a convenience function that only fetches duration.
 func Duration(path string) (time.Duration, error) {
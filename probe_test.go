@@ -1,6 +1,7 @@
 package ffutil
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -75,3 +76,43 @@ func TestMediaInfoStruct(t *testing.T) {
 		t.Error("MediaInfo.HasAudio should be true")
 	}
 }
+
+func TestParseRational(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"30/1", 30},
+		{"25", 25},
+		{"0/0", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRational(tt.in); got != tt.want {
+			t.Errorf("parseRational(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProbeChaptersSorted(t *testing.T) {
+	fakeTool(t, "ffprobe", `cat <<'JSON'
+{"format": {"format_name": "matroska"}, "chapters": [
+  {"id": 2, "start_time": "60.000000", "end_time": "120.000000", "tags": {"title": "Second"}},
+  {"id": 1, "start_time": "0.000000", "end_time": "60.000000", "tags": {"title": "First"}}
+]}
+JSON
+`)
+
+	info, err := Probe("in.mkv")
+	if err != nil {
+		t.Fatalf("Probe() error: %v", err)
+	}
+	var titles []string
+	for _, ch := range info.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if want := []string{"First", "Second"}; !slices.Equal(titles, want) {
+		t.Errorf("chapter titles = %v, want %v", titles, want)
+	}
+}
@@ -0,0 +1,314 @@
+package ffutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultGracePeriod is how long Start waits for ffmpeg to finish after a
+// stop request before killing it, unless GracePeriod is set.
+const DefaultGracePeriod = 10 * time.Second
+
+// GracePeriod makes canceling the context stop ffmpeg gracefully: ffmpeg is
+// sent "q" on stdin (or an interrupt signal when stdin is an input) so it
+// finalizes the output, and is killed if it has not exited after d. By
+// default Run kills ffmpeg as soon as the context is canceled, which can
+// leave outputs such as MP4 files unplayable.
+func (c *Command) GracePeriod(d time.Duration) *Command {
+	c.gracePeriod = d
+	return c
+}
+
+// Process is an ffmpeg command started with Start.
+type Process struct {
+	c       *Command
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *ringBuffer
+	logs    *logWriter
+	started time.Time
+	stop    context.CancelFunc
+
+	// tmp is the temporary output of an AtomicOutput command
+	tmp string
+
+	// progressDone is closed when the progress output has been read
+	progressDone chan struct{}
+
+	mu       sync.Mutex
+	last     Progress
+	stopping bool
+	paused   bool
+
+	waitOnce sync.Once
+	result   *Result
+	err      error
+}
+
+// Start validates and starts the ffmpeg command without waiting for it to
+// finish. Use the returned Process to stop, pause or wait for it. Canceling
+// ctx or calling Stop asks ffmpeg to finish the output and kills it after
+// the grace period (DefaultGracePeriod unless GracePeriod is set). Start
+// does not retry with SoftwareFallback.
+func (c *Command) Start(ctx context.Context) (*Process, error) {
+	if err := c.validateForRun(); err != nil {
+		return nil, err
+	}
+	if err := c.checkOutput(); err != nil {
+		return nil, err
+	}
+	grace := c.gracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	p, err := c.start(ctx, nil, grace, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return p, nil
+}
+
+// start starts the command without validating it, reporting progress to fn
+// if it is not nil and copying stderr (and stdout when it is the output)
+// to output if it is not nil. With a grace period, canceling ctx stops
+// ffmpeg gracefully; otherwise it kills ffmpeg.
+func (c *Command) start(ctx context.Context, fn func(Progress), grace time.Duration, output io.Writer) (p *Process, err error) {
+	build := c.withSupportedHWAccel()
+	args := build.Build()
+	var tmp string
+	if c.writesAtomically() {
+		if tmp, err = tempOutputPath(c.outputPath); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				os.Remove(tmp)
+			}
+		}()
+		temp := *build
+		temp.outputPath = tmp
+		temp.overwrite = true
+		args = temp.Build()
+	}
+	withProgress := c.outputPath != "-"
+	if withProgress {
+		if !c.stats {
+			args = append([]string{"-nostats"}, args...)
+		}
+		args = append([]string{"-progress", "pipe:1"}, args...)
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	p = &Process{
+		c:            c,
+		cmd:          exec.CommandContext(ctx, "ffmpeg", args...),
+		tmp:          tmp,
+		stderr:       newRingBuffer(c.stderrLimit),
+		stop:         stop,
+		progressDone: make(chan struct{}),
+	}
+	stderr := []io.Writer{p.stderr}
+	if output != nil {
+		output = &syncWriter{w: output}
+		stderr = append(stderr, output)
+		if !withProgress {
+			p.cmd.Stdout = output
+		}
+	}
+	if c.logger != nil {
+		p.logs = &logWriter{ctx: ctx, logger: c.logger, level: slog.LevelInfo, limit: c.stderrLimit}
+		stderr = append(stderr, p.logs)
+	}
+	p.cmd.Stderr = io.MultiWriter(stderr...)
+
+	if grace > 0 {
+		if !c.readsStdin() {
+			stdin, err := p.cmd.StdinPipe()
+			if err != nil {
+				stop()
+				return nil, err
+			}
+			p.stdin = stdin
+		}
+		p.cmd.Cancel = p.interrupt
+		p.cmd.WaitDelay = grace
+	}
+
+	var stdout io.Reader
+	if withProgress {
+		if stdout, err = p.cmd.StdoutPipe(); err != nil {
+			stop()
+			return nil, err
+		}
+	}
+
+	p.started = time.Now()
+	if err := p.cmd.Start(); err != nil {
+		stop()
+		return nil, err
+	}
+
+	if stdout == nil {
+		close(p.progressDone)
+		return p, nil
+	}
+	go func() {
+		defer close(p.progressDone)
+		readProgress(stdout, func(progress Progress) {
+			p.mu.Lock()
+			p.last = progress
+			p.mu.Unlock()
+			if fn != nil {
+				fn(progress)
+			}
+		})
+	}()
+	return p, nil
+}
+
+// syncWriter serializes writes to w, which receives both ffmpeg stdout and
+// stderr.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// readsStdin reports whether an input of the command is stdin.
+func (c *Command) readsStdin() bool {
+	for _, in := range c.inputs {
+		if in.path == "-" || in.path == "pipe:" || in.path == "pipe:0" {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop asks ffmpeg to finish writing the output and exit, and kills it if
+// it has not exited after the grace period. Stop returns without waiting;
+// use Wait for the result.
+func (p *Process) Stop() {
+	p.mu.Lock()
+	p.stopping = true
+	p.mu.Unlock()
+	p.stop()
+}
+
+// Kill stops ffmpeg immediately without finalizing the output.
+func (p *Process) Kill() error {
+	return p.cmd.Process.Kill()
+}
+
+// Pause suspends ffmpeg (SIGSTOP). It is not supported on Windows.
+func (p *Process) Pause() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := pauseProcess(p.cmd.Process); err != nil {
+		return fmt.Errorf("pause ffmpeg: %w", err)
+	}
+	p.paused = true
+	return nil
+}
+
+// Resume continues a paused ffmpeg (SIGCONT). It is not supported on
+// Windows.
+func (p *Process) Resume() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := resumeProcess(p.cmd.Process); err != nil {
+		return fmt.Errorf("resume ffmpeg: %w", err)
+	}
+	p.paused = false
+	return nil
+}
+
+// Progress returns the most recent progress update.
+func (p *Process) Progress() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// Wait waits for ffmpeg to exit and returns the run statistics. After
+// Stop, a graceful exit is not an error and Result.Stopped is set. Wait may
+// be called more than once and from multiple goroutines.
+func (p *Process) Wait() (*Result, error) {
+	p.waitOnce.Do(func() {
+		<-p.progressDone
+		err := p.cmd.Wait()
+		p.stop()
+		if p.logs != nil {
+			p.logs.flush()
+		}
+
+		p.mu.Lock()
+		last, stopping := p.last, p.stopping
+		p.mu.Unlock()
+
+		ps := p.cmd.ProcessState
+		wallTime := time.Since(p.started)
+		stopped := stopping && ps != nil && ps.Exited() && (ps.ExitCode() == 0 || ps.ExitCode() == interruptedExitCode)
+		if stopped {
+			err = nil
+		}
+		if err != nil {
+			p.err = fmt.Errorf("ffmpeg failed: %w\nstderr: %s", err, p.stderr.String())
+		}
+
+		var output *MediaInfo
+		if p.tmp != "" {
+			if p.err == nil {
+				output, p.err = commitOutput(p.tmp, p.c.outputPath, p.c.overwrite)
+			}
+			if p.err != nil {
+				os.Remove(p.tmp)
+			}
+		}
+
+		p.result = newResult(p.c, ps, wallTime, last)
+		p.result.Stopped = stopped
+		p.result.Output = output
+	})
+	return p.result, p.err
+}
+
+// interruptedExitCode is the status ffmpeg exits with after finishing the
+// output in response to an interrupt signal.
+const interruptedExitCode = 255
+
+// interrupt asks ffmpeg to finish, by sending "q" on stdin when it is not
+// an input and an interrupt signal otherwise. A paused ffmpeg is resumed
+// first so it can respond.
+func (p *Process) interrupt() error {
+	p.mu.Lock()
+	if p.paused {
+		if err := resumeProcess(p.cmd.Process); err == nil {
+			p.paused = false
+		}
+	}
+	p.mu.Unlock()
+
+	if p.stdin != nil {
+		if _, err := io.WriteString(p.stdin, "q"); err == nil {
+			return nil
+		}
+	}
+	err := p.cmd.Process.Signal(os.Interrupt)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		// Interrupts are not supported on Windows.
+		return p.cmd.Process.Kill()
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package ffutil
+
+import (
+	"errors"
+	"os"
+)
+
+// pauseProcess is not supported on platforms without job control signals.
+func pauseProcess(p *os.Process) error {
+	return errors.ErrUnsupported
+}
+
+// resumeProcess is not supported on platforms without job control signals.
+func resumeProcess(p *os.Process) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,190 @@
+package ffutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessStop(t *testing.T) {
+	fakeFFmpeg(t, `for last; do :; done
+printf 'frame=25\nprogress=continue\n'
+key=$(dd bs=1 count=1 2>/dev/null)
+[ "$key" = q ] || exit 1
+printf 'moov' > "$last"
+printf 'frame=30\nprogress=end\n'
+`)
+
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	p, err := New().Input("in.mp4").Output(out).Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	waitForProgress(t, p)
+	p.Stop()
+
+	result, err := p.Wait()
+	if err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	if !result.Stopped || result.Frames != 30 || result.OutputSize != 4 {
+		t.Errorf("Wait() = %+v, want a stopped run with 30 frames and a finalized output", result)
+	}
+	if again, _ := p.Wait(); again != result {
+		t.Error("second Wait() should return the same result")
+	}
+}
+
+func TestProcessStopInterrupt(t *testing.T) {
+	fakeFFmpeg(t, `trap 'exit 255' INT
+printf 'frame=1\nprogress=continue\n'
+while :; do sleep 0.05; done
+`)
+
+	p, err := New().Input("-").Output(filepath.Join(t.TempDir(), "out.mp4")).Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if p.stdin != nil {
+		t.Error("Start() should not write to stdin when it is an input")
+	}
+	waitForProgress(t, p)
+	p.Stop()
+
+	result, err := p.Wait()
+	if err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	if !result.Stopped {
+		t.Error("Result.Stopped = false, want true")
+	}
+}
+
+func TestProcessGracePeriod(t *testing.T) {
+	fakeFFmpeg(t, `trap '' INT
+printf 'frame=1\nprogress=continue\n'
+while :; do sleep 0.05; done
+`)
+
+	p, err := New().
+		Input("in.mp4").
+		GracePeriod(100 * time.Millisecond).
+		Output(filepath.Join(t.TempDir(), "out.mp4")).
+		Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	waitForProgress(t, p)
+	start := time.Now()
+	p.Stop()
+
+	result, err := p.Wait()
+	if err == nil {
+		t.Fatal("Wait() after the grace period should fail")
+	}
+	if result.Stopped {
+		t.Error("Result.Stopped = true for a killed process")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait() took %v, want the process killed after the grace period", elapsed)
+	}
+}
+
+func TestProcessPause(t *testing.T) {
+	fakeFFmpeg(t, `trap 'exit 255' INT
+printf 'frame=1\nprogress=continue\n'
+while :; do sleep 0.05; done
+`)
+
+	p, err := New().Input("-").Output(filepath.Join(t.TempDir(), "out.mp4")).Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	waitForProgress(t, p)
+	if err := p.Pause(); err != nil {
+		t.Fatalf("Pause() error: %v", err)
+	}
+	if err := p.Resume(); err != nil {
+		t.Fatalf("Resume() error: %v", err)
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatalf("Pause() error: %v", err)
+	}
+
+	// Stop resumes a paused process so it can exit gracefully.
+	p.Stop()
+	if result, err := p.Wait(); err != nil || !result.Stopped {
+		t.Errorf("Wait() = %+v, %v, want a stopped run", result, err)
+	}
+}
+
+func TestRunGracePeriod(t *testing.T) {
+	fakeFFmpeg(t, `for last; do :; done
+printf 'frame=1\nprogress=continue\n'
+dd bs=1 count=1 >/dev/null 2>&1
+printf 'moov' > "$last"
+`)
+
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	ctx, cancel := context.WithCancel(context.Background())
+	err := New().Input("in.mp4").GracePeriod(5*time.Second).Output(out).RunWithProgress(ctx, func(Progress) { cancel() })
+	if err == nil {
+		t.Error("RunWithProgress() with a canceled context should fail")
+	}
+	if data, _ := os.ReadFile(out); string(data) != "moov" {
+		t.Errorf("output = %q, want the output finalized before exit", data)
+	}
+}
+
+// waitForProgress waits for the first progress update so the process is
+// known to be running.
+func waitForProgress(t *testing.T, p *Process) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Progress().Frame == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no progress from ffmpeg")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessNoOverwrite(t *testing.T) {
+	// Like ffmpeg, prompt on stdin for an existing output unless -n or -y
+	// is given.
+	fakeFFmpeg(t, `for last; do :; done
+case " $* " in
+*" -n "*) [ -e "$last" ] && { echo "File '$last' already exists. Exiting." >&2; exit 1; } ;;
+*" -y "*) ;;
+*) [ -e "$last" ] && { printf "File '$last' already exists. Overwrite? [y/N] " >&2; read answer; } ;;
+esac
+printf 'frame=1\nprogress=end\n'
+`)
+
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	if err := os.WriteFile(out, []byte("existing"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New().Input("in.mp4").Overwrite(false).Output(out).Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Wait()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Wait() error = %v, want output exists error", err)
+		}
+	case <-time.After(5 * time.Second):
+		_ = p.Kill()
+		t.Fatal("Wait() did not return; ffmpeg is waiting at the overwrite prompt")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package ffutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseProcess suspends a process with SIGSTOP.
+func pauseProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// resumeProcess continues a suspended process with SIGCONT.
+func resumeProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
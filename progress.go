@@ -0,0 +1,65 @@
+package ffutil
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a progress update reported by ffmpeg while encoding.
+type Progress struct {
+	Frame     int64         // Frames encoded so far
+	FPS       float64       // Current encoding rate in frames per second
+	Bitrate   string        // Current output bitrate (e.g., "1234.5kbits/s")
+	TotalSize int64         // Bytes written so far
+	OutTime   time.Duration // Output timestamp reached
+	Speed     float64       // Encoding speed relative to realtime
+	Done      bool          // True for the final update
+}
+
+// RunWithProgress validates and executes the ffmpeg command, calling fn with
+// each progress update ffmpeg reports. Commands writing to stdout ("-") run
+// without progress updates.
+func (c *Command) RunWithProgress(ctx context.Context, fn func(Progress)) error {
+	_, err := c.run(ctx, fn)
+	return err
+}
+
+// readProgress parses "-progress" output, which is a series of key=value
+// blocks each terminated by a "progress=continue" or "progress=end" line.
+func readProgress(r io.Reader, fn func(Progress)) {
+	var p Progress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || value == "N/A" {
+			continue
+		}
+		switch key {
+		case "frame":
+			p.Frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			p.FPS, _ = strconv.ParseFloat(value, 64)
+		case "bitrate":
+			p.Bitrate = value
+		case "total_size":
+			p.TotalSize, _ = strconv.ParseInt(value, 10, 64)
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			p.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			p.Done = value == "end"
+			if fn != nil {
+				fn(p)
+			}
+		}
+	}
+	// Drain the rest so ffmpeg never blocks on a full pipe.
+	_, _ = io.Copy(io.Discard, r)
+}
@@ -0,0 +1,44 @@
+package ffutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProgress(t *testing.T) {
+	output := `frame=30
+fps=29.97
+stream_0_0_q=28.0
+bitrate=1234.5kbits/s
+total_size=65536
+out_time_us=1001000
+out_time=00:00:01.001000
+speed=1.5x
+progress=continue
+frame=60
+fps=30.00
+bitrate=N/A
+total_size=131072
+out_time_us=2002000
+speed=2.01x
+progress=end
+`
+	var got []Progress
+	readProgress(strings.NewReader(output), func(p Progress) {
+		got = append(got, p)
+	})
+
+	want := []Progress{
+		{Frame: 30, FPS: 29.97, Bitrate: "1234.5kbits/s", TotalSize: 65536, OutTime: 1001 * time.Millisecond, Speed: 1.5},
+		{Frame: 60, FPS: 30, Bitrate: "1234.5kbits/s", TotalSize: 131072, OutTime: 2002 * time.Millisecond, Speed: 2.01, Done: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("readProgress() returned %d updates, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("update %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
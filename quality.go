@@ -0,0 +1,283 @@
+package ffutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// QualityMetric identifies an objective video quality metric.
+type QualityMetric string
+
+// Supported quality metrics.
+const (
+	MetricVMAF QualityMetric = "vmaf"
+	MetricPSNR QualityMetric = "psnr"
+	MetricSSIM QualityMetric = "ssim"
+)
+
+// CompareOptions configures a quality comparison.
+type CompareOptions struct {
+	// Metrics selects the metrics to compute (default all).
+	Metrics []QualityMetric
+
+	// PerFrame includes per-frame scores in the report.
+	PerFrame bool
+
+	// VMAFModel selects the libvmaf model version (e.g., "vmaf_4k_v0.6.1").
+	// Empty uses the libvmaf default.
+	VMAFModel string
+
+	// Threads sets the number of libvmaf threads. Zero uses the libvmaf default.
+	Threads int
+}
+
+// QualityReport contains the results of a quality comparison.
+// Scores for metrics that were not computed are zero.
+type QualityReport struct {
+	// VMAF is the pooled VMAF score, from 0 to 100
+	VMAF float64 `json:"vmaf,omitempty"`
+
+	// PSNR is the average PSNR in dB
+	PSNR float64 `json:"psnr,omitempty"`
+
+	// SSIM is the average SSIM, from 0 to 1
+	SSIM float64 `json:"ssim,omitempty"`
+
+	// Frames contains per-frame scores when requested
+	Frames []FrameQuality `json:"frames,omitempty"`
+}
+
+// FrameQuality contains the quality scores of a single frame.
+type FrameQuality struct {
+	Frame int     `json:"frame"`
+	VMAF  float64 `json:"vmaf,omitempty"`
+	PSNR  float64 `json:"psnr,omitempty"`
+	SSIM  float64 `json:"ssim,omitempty"`
+}
+
+// Compare measures the quality of a distorted video against a reference.
+// The distorted video is scaled and resampled to the resolution and frame
+// rate of the reference before comparison.
+func Compare(ctx context.Context, reference, distorted string, opts CompareOptions) (*QualityReport, error) {
+	ref, err := Probe(reference)
+	if err != nil {
+		return nil, err
+	}
+	if !ref.HasVideo {
+		return nil, fmt.Errorf("reference %s has no video stream", reference)
+	}
+
+	dir, err := os.MkdirTemp("", "ffutil-compare-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	metrics := opts.Metrics
+	if len(metrics) == 0 {
+		metrics = []QualityMetric{MetricVMAF, MetricPSNR, MetricSSIM}
+	}
+
+	output, err := New().
+		Input(distorted).
+		Input(reference).
+		FilterComplex(compareFilter(ref, metrics, dir, opts)).
+		NoAudio().
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := parseQualityLog(string(output))
+	if opts.PerFrame {
+		if report.Frames, err = readFrameQuality(dir, metrics); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// compareFilter builds a filter graph that aligns input 0 (distorted) to
+// input 1 (reference) and feeds both into each metric filter.
+func compareFilter(ref *MediaInfo, metrics []QualityMetric, dir string, opts CompareOptions) string {
+	n := len(metrics)
+
+	var align []string
+	if ref.Width > 0 && ref.Height > 0 {
+		align = append(align, fmt.Sprintf("scale=%d:%d:flags=bicubic", ref.Width, ref.Height))
+	}
+	var refAlign []string
+	if ref.FrameRate > 0 {
+		fps := fmt.Sprintf("fps=%s", formatFloat(ref.FrameRate))
+		align = append(align, fps)
+		refAlign = append(refAlign, fps)
+	}
+	align = append(align, "setpts=PTS-STARTPTS", fmt.Sprintf("split=%d", n))
+	refAlign = append(refAlign, "setpts=PTS-STARTPTS", fmt.Sprintf("split=%d", n))
+
+	var dist, refs strings.Builder
+	for i := range metrics {
+		fmt.Fprintf(&dist, "[d%d]", i)
+		fmt.Fprintf(&refs, "[r%d]", i)
+	}
+
+	chains := []string{
+		"[0:v]" + strings.Join(align, ",") + dist.String(),
+		"[1:v]" + strings.Join(refAlign, ",") + refs.String(),
+	}
+	for i, m := range metrics {
+		pads := fmt.Sprintf("[d%d][r%d]", i, i)
+		logPath := escapeFilterValue(filepath.Join(dir, string(m)+".log"))
+		switch m {
+		case MetricVMAF:
+			f := "libvmaf=log_fmt=json:log_path=" + logPath
+			if opts.VMAFModel != "" {
+				f += ":model=version=" + opts.VMAFModel
+			}
+			if opts.Threads > 0 {
+				f += fmt.Sprintf(":n_threads=%d", opts.Threads)
+			}
+			chains = append(chains, pads+f)
+		case MetricPSNR, MetricSSIM:
+			chains = append(chains, pads+string(m)+"=stats_file="+logPath)
+		}
+	}
+	return strings.Join(chains, ";")
+}
+
+// parseQualityLog extracts pooled scores from the filter summary lines:
+//
+//	[Parsed_libvmaf_6 @ 0x...] VMAF score: 95.12
+//	[Parsed_psnr_7 @ 0x...] PSNR y:40.1 u:45.1 v:46.0 average:41.5 min:35.2 max:50.1
+//	[Parsed_ssim_8 @ 0x...] SSIM Y:0.98 (17.1) U:0.99 (20.0) V:0.99 (20.1) All:0.985 (18.2)
+func parseQualityLog(log string) *QualityReport {
+	report := &QualityReport{}
+	for _, line := range logLines(log) {
+		switch {
+		case strings.Contains(line, "VMAF score:"):
+			_, v, _ := strings.Cut(line, "VMAF score:")
+			report.VMAF = parseScore(v)
+		case strings.Contains(line, "[Parsed_psnr"):
+			if v, ok := statsValue(line, "average:"); ok {
+				report.PSNR = v
+			}
+		case strings.Contains(line, "[Parsed_ssim"):
+			if v, ok := statsValue(line, "All:"); ok {
+				report.SSIM = v
+			}
+		}
+	}
+	return report
+}
+
+// readFrameQuality reads the per-frame logs written by the metric filters.
+func readFrameQuality(dir string, metrics []QualityMetric) ([]FrameQuality, error) {
+	var frames []FrameQuality
+	frame := func(i int) *FrameQuality {
+		for len(frames) <= i {
+			frames = append(frames, FrameQuality{Frame: len(frames)})
+		}
+		return &frames[i]
+	}
+
+	for _, m := range metrics {
+		data, err := os.ReadFile(filepath.Join(dir, string(m)+".log"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s log: %w", m, err)
+		}
+		switch m {
+		case MetricVMAF:
+			scores, err := parseVMAFLog(data)
+			if err != nil {
+				return nil, err
+			}
+			for i, v := range scores {
+				frame(i).VMAF = v
+			}
+		case MetricPSNR:
+			for i, v := range parseStatsFile(string(data), "psnr_avg:") {
+				frame(i).PSNR = v
+			}
+		case MetricSSIM:
+			for i, v := range parseStatsFile(string(data), "All:") {
+				frame(i).SSIM = v
+			}
+		}
+	}
+	return frames, nil
+}
+
+// vmafLog represents the JSON log written by libvmaf.
+type vmafLog struct {
+	Frames []struct {
+		FrameNum int `json:"frameNum"`
+		Metrics  struct {
+			VMAF float64 `json:"vmaf"`
+		} `json:"metrics"`
+	} `json:"frames"`
+}
+
+// parseVMAFLog returns per-frame VMAF scores indexed by frame number.
+func parseVMAFLog(data []byte) ([]float64, error) {
+	var log vmafLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, fmt.Errorf("failed to parse vmaf log: %w", err)
+	}
+	scores := make([]float64, len(log.Frames))
+	for i, f := range log.Frames {
+		if f.FrameNum >= 0 && f.FrameNum < len(scores) {
+			scores[f.FrameNum] = f.Metrics.VMAF
+		} else {
+			scores[i] = f.Metrics.VMAF
+		}
+	}
+	return scores, nil
+}
+
+// parseStatsFile returns the value following key on each line of a
+// psnr or ssim stats file, in frame order.
+func parseStatsFile(data, key string) []float64 {
+	var values []float64
+	for _, line := range logLines(data) {
+		if v, ok := statsValue(line, key); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// statsValue returns the number following key in a line of filter output.
+func statsValue(line, key string) (float64, bool) {
+	i := strings.Index(line, key)
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(line[i+len(key):])
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	return v, err == nil
+}
+
+func parseScore(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v
+}
+
+// escapeFilterValue escapes a value, such as a file path, for use as a
+// filter option inside a filter graph. Special characters are escaped
+// first for the option parser and then for the filter graph parser.
+func escapeFilterValue(s string) string {
+	opt := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(
+		`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`,
+	).Replace(opt)
+}
@@ -0,0 +1,82 @@
+package ffutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareFilter(t *testing.T) {
+	ref := &MediaInfo{Width: 1920, Height: 1080, FrameRate: 25}
+	metrics := []QualityMetric{MetricVMAF, MetricPSNR, MetricSSIM}
+
+	filter := compareFilter(ref, metrics, "/tmp/cmp", CompareOptions{Threads: 4})
+
+	wants := []string{
+		"[0:v]scale=1920:1080:flags=bicubic,fps=25,setpts=PTS-STARTPTS,split=3[d0][d1][d2]",
+		"[1:v]fps=25,setpts=PTS-STARTPTS,split=3[r0][r1][r2]",
+		"[d0][r0]libvmaf=log_fmt=json:log_path=/tmp/cmp/vmaf.log:n_threads=4",
+		"[d1][r1]psnr=stats_file=/tmp/cmp/psnr.log",
+		"[d2][r2]ssim=stats_file=/tmp/cmp/ssim.log",
+	}
+	for _, want := range wants {
+		if !strings.Contains(filter, want) {
+			t.Errorf("compareFilter() missing %q in %s", want, filter)
+		}
+	}
+}
+
+func TestParseQualityLog(t *testing.T) {
+	log := `[Parsed_libvmaf_6 @ 0x600] VMAF score: 95.123456
+[Parsed_psnr_7 @ 0x600] PSNR y:40.12 u:45.10 v:46.00 average:41.50 min:35.20 max:50.10
+[Parsed_ssim_8 @ 0x600] SSIM Y:0.980 (16.98) U:0.990 (20.00) V:0.990 (20.00) All:0.985 (18.24)
+`
+	report := parseQualityLog(log)
+
+	if report.VMAF != 95.123456 {
+		t.Errorf("VMAF = %v, want 95.123456", report.VMAF)
+	}
+	if report.PSNR != 41.5 {
+		t.Errorf("PSNR = %v, want 41.5", report.PSNR)
+	}
+	if report.SSIM != 0.985 {
+		t.Errorf("SSIM = %v, want 0.985", report.SSIM)
+	}
+}
+
+func TestParseFrameLogs(t *testing.T) {
+	vmaf := []byte(`{"frames":[{"frameNum":0,"metrics":{"vmaf":91.5}},{"frameNum":1,"metrics":{"vmaf":93.25}}]}`)
+	scores, err := parseVMAFLog(vmaf)
+	if err != nil {
+		t.Fatalf("parseVMAFLog() error: %v", err)
+	}
+	if len(scores) != 2 || scores[1] != 93.25 {
+		t.Errorf("parseVMAFLog() = %v, want [91.5 93.25]", scores)
+	}
+
+	psnr := "n:1 mse_avg:0.52 mse_y:0.60 psnr_avg:50.97 psnr_y:50.35\nn:2 mse_avg:0.61 mse_y:0.70 psnr_avg:50.27 psnr_y:49.68\n"
+	if got := parseStatsFile(psnr, "psnr_avg:"); len(got) != 2 || got[0] != 50.97 {
+		t.Errorf("parseStatsFile(psnr) = %v", got)
+	}
+
+	ssim := "n:1 Y:0.991 U:0.995 V:0.994 All:0.992 (21.0)\n"
+	if got := parseStatsFile(ssim, "All:"); len(got) != 1 || got[0] != 0.992 {
+		t.Errorf("parseStatsFile(ssim) = %v", got)
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/tmp/a.log", "/tmp/a.log"},
+		{`C:\logs\a.log`, `C\\:\\\\logs\\\\a.log`},
+		{"it's,[x].srt", `it\\\'s\,\[x\].srt`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeFilterValue(tt.in); got != tt.want {
+			t.Errorf("escapeFilterValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package ffutil
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQueueClosed is returned when submitting to a closed Queue.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// JobState is the lifecycle state of a queued job.
+type JobState int
+
+// Job states.
+const (
+	JobPending JobState = iota
+	JobRunning
+	JobSucceeded
+	JobFailed
+	JobCanceled
+)
+
+// String returns the state name.
+func (s JobState) String() string {
+	switch s {
+	case JobPending:
+		return "pending"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobCanceled:
+		return "canceled"
+	}
+	return fmt.Sprintf("JobState(%d)", int(s))
+}
+
+// QueueOptions configures a Queue.
+type QueueOptions struct {
+	// Workers is the maximum number of jobs running at once
+	// (default: runtime.NumCPU())
+	Workers int
+
+	// EncoderLimits caps the number of concurrent jobs per encoder. Keys are
+	// encoder names such as "libx264", or hardware families such as "nvenc"
+	// that match every encoder with that suffix (h264_nvenc, hevc_nvenc).
+	EncoderLimits map[string]int
+
+	// MaxRetries is the number of times a job failing with a transient
+	// error is retried (default: 0)
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further retry (default: 1s)
+	RetryBackoff time.Duration
+
+	// IsTransient reports whether a failed job may be retried
+	// (default: IsTransientError)
+	IsTransient func(error) bool
+
+	// BudgetThreads shares CPUThreads between running jobs: each job is
+	// given a thread count (-threads and -filter_threads) and only starts
+	// when its threads are free, so parallel software encodes do not
+	// oversubscribe cores. Commands that set Threads keep their setting.
+	BudgetThreads bool
+
+	// CPUThreads is the thread budget when BudgetThreads is set
+	// (default: runtime.NumCPU())
+	CPUThreads int
+
+	// OnEvent is called for every job lifecycle change and progress update.
+	// It is called from worker goroutines and must be safe for concurrent use.
+	OnEvent func(JobEvent)
+}
+
+// JobOptions configures a submitted job.
+type JobOptions struct {
+	// ID identifies the job in events (default: "job-N")
+	ID string
+
+	// Priority orders pending jobs; higher priorities run first and jobs
+	// with equal priority run in submission order
+	Priority int
+
+	// Weight scales the job's share of the thread budget when
+	// QueueOptions.BudgetThreads is set (default: 1)
+	Weight int
+}
+
+// JobEvent reports a job state change or progress update. Progress is set
+// for progress updates of a running job. Err is set for failed and canceled
+// jobs, and for pending jobs waiting to be retried.
+type JobEvent struct {
+	Job      *Job
+	State    JobState
+	Attempt  int
+	Progress *Progress
+	Err      error
+}
+
+// Queue runs Commands on a pool of workers, enforcing global and
+// per-encoder concurrency limits.
+type Queue struct {
+	opts QueueOptions
+	run  func(context.Context, *Command, func(Progress)) error
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Job
+	active  map[string]int
+	threads int
+	seq     int
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// Job is a Command submitted to a Queue.
+type Job struct {
+	ID       string
+	Priority int
+	Weight   int
+	Command  *Command
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	seq     int
+	limits  []string
+	readyAt time.Time
+	done    chan struct{}
+
+	mu       sync.Mutex
+	state    JobState
+	attempt  int
+	threads  int
+	err      error
+	progress Progress
+}
+
+// NewQueue creates a queue and starts its workers. Call Close to stop them.
+func NewQueue(opts QueueOptions) *Queue {
+	return newQueue(opts, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		return c.RunWithProgress(ctx, fn)
+	})
+}
+
+func newQueue(opts QueueOptions, run func(context.Context, *Command, func(Progress)) error) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	if opts.IsTransient == nil {
+		opts.IsTransient = IsTransientError
+	}
+	if opts.CPUThreads <= 0 {
+		opts.CPUThreads = runtime.NumCPU()
+	}
+
+	q := &Queue{
+		opts:   opts,
+		run:    run,
+		active: make(map[string]int),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for range opts.Workers {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit adds a command to the queue. The job is canceled when ctx is
+// canceled or Job.Cancel is called.
+func (q *Queue) Submit(ctx context.Context, cmd *Command, opts JobOptions) (*Job, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrQueueClosed
+	}
+	q.seq++
+	j := &Job{
+		ID:       opts.ID,
+		Priority: opts.Priority,
+		Weight:   max(opts.Weight, 1),
+		Command:  cmd,
+		seq:      q.seq,
+		limits:   q.limitKeys(cmd),
+		done:     make(chan struct{}),
+	}
+	if j.ID == "" {
+		j.ID = fmt.Sprintf("job-%d", j.seq)
+	}
+	q.mu.Unlock()
+	j.ctx, j.cancel = context.WithCancel(ctx)
+
+	// Report the job before a worker can pick it up.
+	q.emit(JobEvent{Job: j, State: JobPending})
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.finish(j, JobCanceled, ErrQueueClosed)
+		return nil, ErrQueueClosed
+	}
+	q.push(j)
+	q.mu.Unlock()
+
+	context.AfterFunc(j.ctx, func() {
+		if q.remove(j) {
+			q.finish(j, JobCanceled, j.ctx.Err())
+		}
+	})
+	return j, nil
+}
+
+// Close stops accepting jobs and waits for all submitted jobs to finish.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.workers.Wait()
+}
+
+// Cancel cancels the job, stopping ffmpeg if it is running.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel that is closed when the job finishes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job to finish and returns its error.
+func (j *Job) Wait() error {
+	<-j.done
+	return j.Err()
+}
+
+// State returns the current state of the job.
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Err returns the error of a failed or canceled job.
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Attempts returns the number of times the job has been started.
+func (j *Job) Attempts() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.attempt
+}
+
+// Threads returns the thread count assigned to the job by the thread
+// budget, or 0 if the queue does not budget threads.
+func (j *Job) Threads() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.threads
+}
+
+// Progress returns the latest progress update of the job.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		j := q.next()
+		if j == nil {
+			return
+		}
+		q.runJob(j)
+	}
+}
+
+// next blocks until a job can start and reserves its encoder slots. It
+// returns nil once the queue is closed and no jobs are pending.
+func (q *Queue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		var wake time.Time
+		now := time.Now()
+		for i, j := range q.pending {
+			if j.readyAt.After(now) {
+				if wake.IsZero() || j.readyAt.Before(wake) {
+					wake = j.readyAt
+				}
+				continue
+			}
+			if !q.hasCapacity(j) {
+				continue
+			}
+			threads := 0
+			if q.opts.BudgetThreads {
+				threads = q.threadDemand(j)
+				if q.threads+threads > q.opts.CPUThreads {
+					continue
+				}
+			}
+			q.pending = slices.Delete(q.pending, i, i+1)
+			for _, key := range j.limits {
+				q.active[key]++
+			}
+			q.threads += threads
+			j.mu.Lock()
+			j.threads = threads
+			j.mu.Unlock()
+			return j
+		}
+		if q.closed && len(q.pending) == 0 {
+			return nil
+		}
+		if !wake.IsZero() {
+			time.AfterFunc(time.Until(wake), q.broadcast)
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *Queue) runJob(j *Job) {
+	j.mu.Lock()
+	j.state = JobRunning
+	j.attempt++
+	attempt := j.attempt
+	threads := j.threads
+	j.mu.Unlock()
+	q.emit(JobEvent{Job: j, State: JobRunning, Attempt: attempt})
+
+	cmd := j.Command
+	if threads > 0 && cmd.threads == 0 {
+		budgeted := *cmd
+		budgeted.threads = threads
+		if budgeted.filterThreads == 0 {
+			budgeted.filterThreads = threads
+		}
+		cmd = &budgeted
+	}
+	err := q.run(j.ctx, cmd, func(p Progress) {
+		j.mu.Lock()
+		j.progress = p
+		j.mu.Unlock()
+		q.emit(JobEvent{Job: j, State: JobRunning, Attempt: attempt, Progress: &p})
+	})
+
+	q.mu.Lock()
+	for _, key := range j.limits {
+		q.active[key]--
+	}
+	q.threads -= threads
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		q.finish(j, JobSucceeded, nil)
+	case j.ctx.Err() != nil:
+		q.finish(j, JobCanceled, err)
+	case attempt <= q.opts.MaxRetries && q.opts.IsTransient(err):
+		q.retry(j, attempt, err)
+	default:
+		q.finish(j, JobFailed, err)
+	}
+}
+
+// retry puts the job back in the queue after a backoff delay.
+func (q *Queue) retry(j *Job, attempt int, err error) {
+	backoff := q.opts.RetryBackoff << (attempt - 1)
+
+	q.mu.Lock()
+	if j.ctx.Err() != nil {
+		q.mu.Unlock()
+		q.finish(j, JobCanceled, err)
+		return
+	}
+	j.mu.Lock()
+	j.state = JobPending
+	j.mu.Unlock()
+	j.readyAt = time.Now().Add(backoff)
+	q.push(j)
+	q.mu.Unlock()
+
+	q.emit(JobEvent{Job: j, State: JobPending, Attempt: attempt, Err: err})
+}
+
+func (q *Queue) finish(j *Job, state JobState, err error) {
+	j.mu.Lock()
+	j.state = state
+	j.err = err
+	attempt := j.attempt
+	j.mu.Unlock()
+	close(j.done)
+	j.cancel()
+	q.emit(JobEvent{Job: j, State: state, Attempt: attempt, Err: err})
+}
+
+// push inserts the job into the pending list ordered by priority and
+// submission order. q.mu must be held.
+func (q *Queue) push(j *Job) {
+	i, _ := slices.BinarySearchFunc(q.pending, j, func(a, b *Job) int {
+		if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	q.pending = slices.Insert(q.pending, i, j)
+	q.cond.Broadcast()
+}
+
+// remove removes a pending job and reports whether it was pending.
+func (q *Queue) remove(j *Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.Index(q.pending, j)
+	if i < 0 {
+		return false
+	}
+	q.pending = slices.Delete(q.pending, i, i+1)
+	q.cond.Broadcast()
+	return true
+}
+
+func (q *Queue) broadcast() {
+	q.mu.Lock()
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *Queue) hasCapacity(j *Job) bool {
+	for _, key := range j.limits {
+		if q.active[key] >= q.opts.EncoderLimits[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// hardwareJobThreads is the thread demand of a hardware encode, whose CPU
+// work is limited to demuxing, decoding and filtering.
+const hardwareJobThreads = 2
+
+// threadDemand returns the number of budget threads the job needs: the
+// command's Threads if set, one thread for stream copies, a fixed small
+// count for hardware encoders and a weighted share of the budget per
+// worker for software encoders.
+func (q *Queue) threadDemand(j *Job) int {
+	c := j.Command
+	var n int
+	switch {
+	case c.threads > 0:
+		n = c.threads
+	case c.noVideo || c.copyVideo || c.videoCodec == "":
+		n = 1
+	case encoderByName(c.videoCodec).Type == "hardware":
+		n = hardwareJobThreads
+	default:
+		n = max(1, q.opts.CPUThreads*j.Weight/q.opts.Workers)
+	}
+	return min(n, q.opts.CPUThreads)
+}
+
+// limitKeys returns the EncoderLimits keys matching the command's encoders.
+func (q *Queue) limitKeys(c *Command) []string {
+	var keys []string
+	for _, codec := range c.encoders() {
+		for key, limit := range q.opts.EncoderLimits {
+			if limit > 0 && (codec == key || strings.HasSuffix(codec, "_"+key)) && !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func (q *Queue) emit(e JobEvent) {
+	if q.opts.OnEvent != nil {
+		q.opts.OnEvent(e)
+	}
+}
+
+// encoders returns the video and audio encoders the command uses.
+func (c *Command) encoders() []string {
+	var names []string
+	if !c.noVideo && !c.copyVideo && c.videoCodec != "" {
+		names = append(names, c.videoCodec)
+	}
+	if !c.noAudio && !c.copyAudio && c.audioCodec != "" {
+		names = append(names, c.audioCodec)
+	}
+	return names
+}
+
+// transientErrors are ffmpeg messages for failures that may succeed when
+// retried, such as exhausted hardware sessions or network errors.
+var transientErrors = []string{
+	"OpenEncodeSessionEx failed",
+	"No NVENC capable devices found",
+	"out of memory",
+	"Resource temporarily unavailable",
+	"Device or resource busy",
+	"Connection reset by peer",
+	"Connection timed out",
+	"Connection refused",
+	"Server returned 5",
+	"Temporary failure in name resolution",
+}
+
+// IsTransientError reports whether an ffmpeg error looks temporary, such as
+// a hardware encoder session limit or a network failure. Context
+// cancellation is never transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	msg := err.Error()
+	for _, s := range transientErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package ffutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueuePriority(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	q := newQueue(QueueOptions{Workers: 1}, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		if c.outputPath == "blocker.mp4" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, c.outputPath)
+		mu.Unlock()
+		return nil
+	})
+
+	submit := func(output string, priority int) *Job {
+		t.Helper()
+		j, err := q.Submit(context.Background(), New().Input("in.mp4").Output(output), JobOptions{Priority: priority})
+		if err != nil {
+			t.Fatalf("Submit() error: %v", err)
+		}
+		return j
+	}
+
+	blocker := submit("blocker.mp4", 0)
+	for blocker.State() != JobRunning {
+		time.Sleep(time.Millisecond)
+	}
+	submit("low.mp4", 0)
+	submit("high.mp4", 10)
+	submit("low2.mp4", 0)
+	close(release)
+	q.Close()
+
+	want := []string{"blocker.mp4", "high.mp4", "low.mp4", "low2.mp4"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestQueueEncoderLimits(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	q := newQueue(QueueOptions{Workers: 4, EncoderLimits: map[string]int{"nvenc": 1}}, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	var jobs []*Job
+	for _, codec := range []string{"h264_nvenc", "hevc_nvenc", "h264_nvenc"} {
+		j, err := q.Submit(context.Background(), New().Input("in.mp4").VideoCodec(codec).Output("out.mp4"), JobOptions{})
+		if err != nil {
+			t.Fatalf("Submit() error: %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+	q.Close()
+
+	if peak != 1 {
+		t.Errorf("peak concurrent nvenc jobs = %d, want 1", peak)
+	}
+	for _, j := range jobs {
+		if j.State() != JobSucceeded {
+			t.Errorf("%s state = %v, want succeeded", j.ID, j.State())
+		}
+	}
+}
+
+func TestQueueRetry(t *testing.T) {
+	calls := 0
+	var events []JobState
+	var mu sync.Mutex
+	q := newQueue(QueueOptions{
+		Workers:      1,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+		OnEvent: func(e JobEvent) {
+			mu.Lock()
+			events = append(events, e.State)
+			mu.Unlock()
+		},
+	}, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		calls++
+		if calls < 3 {
+			return errors.New("ffmpeg failed: OpenEncodeSessionEx failed: out of memory")
+		}
+		fn(Progress{Frame: 10, Done: true})
+		return nil
+	})
+
+	j, err := q.Submit(context.Background(), New().Input("in.mp4").Output("out.mp4"), JobOptions{ID: "retry"})
+	if err != nil {
+		t.Fatalf("Submit() error: %v", err)
+	}
+	if err := j.Wait(); err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	q.Close()
+
+	if j.Attempts() != 3 {
+		t.Errorf("Attempts() = %d, want 3", j.Attempts())
+	}
+	if j.Progress().Frame != 10 {
+		t.Errorf("Progress().Frame = %d, want 10", j.Progress().Frame)
+	}
+	want := []JobState{JobPending, JobRunning, JobPending, JobRunning, JobPending, JobRunning, JobRunning, JobSucceeded}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", events, want)
+		}
+	}
+}
+
+func TestQueueCancelPending(t *testing.T) {
+	release := make(chan struct{})
+	q := newQueue(QueueOptions{Workers: 1}, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		<-release
+		return nil
+	})
+
+	first, _ := q.Submit(context.Background(), New().Input("in.mp4").Output("a.mp4"), JobOptions{})
+	second, _ := q.Submit(context.Background(), New().Input("in.mp4").Output("b.mp4"), JobOptions{})
+	second.Cancel()
+	<-second.Done()
+	close(release)
+	q.Close()
+
+	if first.State() != JobSucceeded {
+		t.Errorf("first state = %v, want succeeded", first.State())
+	}
+	if second.State() != JobCanceled || !errors.Is(second.Err(), context.Canceled) {
+		t.Errorf("second state = %v, err = %v, want canceled", second.State(), second.Err())
+	}
+	if _, err := q.Submit(context.Background(), New(), JobOptions{}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Submit() after Close error = %v, want ErrQueueClosed", err)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("ffmpeg failed: exit status 1\nstderr: OpenEncodeSessionEx failed: incompatible client key (21)"), true},
+		{errors.New("ffmpeg failed: exit status 1\nstderr: Connection reset by peer"), true},
+		{errors.New("ffmpeg failed: exit status 1\nstderr: in.mp4: No such file or directory"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransientError(tt.err); got != tt.want {
+			t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestQueueThreadDemand(t *testing.T) {
+	q := &Queue{opts: QueueOptions{Workers: 4, CPUThreads: 8}}
+	tests := []struct {
+		name   string
+		cmd    *Command
+		weight int
+		want   int
+	}{
+		{"software", New().VideoCodec("libx264"), 1, 2},
+		{"weighted software", New().VideoCodec("libx264"), 2, 4},
+		{"weight capped to budget", New().VideoCodec("libx265"), 10, 8},
+		{"hardware", New().VideoCodec("h264_nvenc"), 1, hardwareJobThreads},
+		{"stream copy", New().CopyVideo(), 1, 1},
+		{"audio only", New().NoVideo().AudioCodec("aac"), 1, 1},
+		{"explicit threads", New().VideoCodec("libx264").Threads(3), 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &Job{Command: tt.cmd, Weight: tt.weight}
+			if got := q.threadDemand(j); got != tt.want {
+				t.Errorf("threadDemand() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueBudgetThreads(t *testing.T) {
+	var mu sync.Mutex
+	used, peak := 0, 0
+	q := newQueue(QueueOptions{Workers: 4, BudgetThreads: true, CPUThreads: 4}, func(ctx context.Context, c *Command, fn func(Progress)) error {
+		mu.Lock()
+		used += c.threads
+		peak = max(peak, used)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		used -= c.threads
+		mu.Unlock()
+		return nil
+	})
+
+	cmd := New().Input("in.mp4").VideoCodec("libx264").Output("out.mp4")
+	var jobs []*Job
+	for _, weight := range []int{1, 4, 1, 2} {
+		j, err := q.Submit(context.Background(), cmd, JobOptions{Weight: weight})
+		if err != nil {
+			t.Fatalf("Submit() error: %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+	q.Close()
+
+	if peak > 4 {
+		t.Errorf("peak threads = %d, want at most 4", peak)
+	}
+	for i, want := range []int{1, 4, 1, 2} {
+		if got := jobs[i].Threads(); got != want {
+			t.Errorf("job %d Threads() = %d, want %d", i, got, want)
+		}
+	}
+	if cmd.threads != 0 {
+		t.Errorf("submitted command threads = %d, want unchanged 0", cmd.threads)
+	}
+}
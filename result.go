@@ -0,0 +1,95 @@
+package ffutil
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Result describes an ffmpeg run. After a software fallback the statistics
+// describe the fallback run.
+type Result struct {
+	// VideoEncoder is the video encoder used. After a software fallback it
+	// is the software equivalent of the configured encoder.
+	VideoEncoder string
+
+	// Fallback reports whether the run was retried with a software encoder
+	Fallback bool
+
+	// FallbackCause is the hardware encoder error that caused the fallback
+	FallbackCause error
+
+	// Stopped reports whether the run was ended early by Process.Stop. The
+	// output holds what was encoded before the stop.
+	Stopped bool
+
+	// WallTime is the elapsed time of the ffmpeg process
+	WallTime time.Duration
+
+	// UserTime and SystemTime are the CPU time used by the ffmpeg process
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	// PeakRSS is the maximum resident set size of the ffmpeg process in
+	// bytes (0 if the platform does not report it)
+	PeakRSS int64
+
+	// Speed is the final encoding speed relative to realtime
+	Speed float64
+
+	// Frames is the number of video frames encoded
+	Frames int64
+
+	// OutputSize is the size of the output file in bytes
+	OutputSize int64
+
+	// Output is the probed output file, set by RunResult when the output
+	// is a file that ffprobe can read, and by AtomicOutput runs
+	Output *MediaInfo
+}
+
+// CPUTime returns the total CPU time used by the ffmpeg process.
+func (r *Result) CPUTime() time.Duration {
+	return r.UserTime + r.SystemTime
+}
+
+// RunResult validates and executes the command like Run and returns a
+// Result with run statistics and a probe of the output file. The Result is
+// also returned when ffmpeg fails, and is nil only if the command is invalid.
+func (c *Command) RunResult(ctx context.Context) (*Result, error) {
+	result, err := c.run(ctx, nil)
+	if err != nil || result.OutputSize == 0 || result.Output != nil {
+		return result, err
+	}
+	if info, probeErr := Probe(c.outputPath); probeErr == nil {
+		result.Output = info
+	}
+	return result, nil
+}
+
+// newResult collects the statistics of a finished ffmpeg process. ps is
+// nil if the process did not start.
+func newResult(c *Command, ps *os.ProcessState, wallTime time.Duration, last Progress) *Result {
+	result := &Result{
+		VideoEncoder: c.videoCodec,
+		WallTime:     wallTime,
+		Speed:        last.Speed,
+		Frames:       last.Frame,
+	}
+	if ps != nil {
+		result.UserTime = ps.UserTime()
+		result.SystemTime = ps.SystemTime()
+		result.PeakRSS = peakRSS(ps)
+	}
+	if c.outputPath != "" && c.outputPath != "-" {
+		if fi, err := os.Stat(c.outputPath); err == nil && fi.Mode().IsRegular() {
+			result.OutputSize = fi.Size()
+		}
+	}
+	return result
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
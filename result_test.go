@@ -0,0 +1,64 @@
+package ffutil
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunResult(t *testing.T) {
+	fakeFFmpeg(t, `for last; do :; done
+printf 'frame=120\nspeed=2.5x\nprogress=continue\nframe=240\nspeed=3.25x\nprogress=end\n'
+printf '0123456789' > "$last"
+`)
+
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	result, err := New().Input("in.mp4").VideoCodec("libx264").Output(out).RunResult(context.Background())
+	if err != nil {
+		t.Fatalf("RunResult() error: %v", err)
+	}
+	if result.VideoEncoder != "libx264" || result.Fallback {
+		t.Errorf("VideoEncoder = %q, Fallback = %v, want libx264 without fallback", result.VideoEncoder, result.Fallback)
+	}
+	if result.Frames != 240 {
+		t.Errorf("Frames = %d, want 240", result.Frames)
+	}
+	if result.Speed != 3.25 {
+		t.Errorf("Speed = %v, want 3.25", result.Speed)
+	}
+	if result.OutputSize != 10 {
+		t.Errorf("OutputSize = %d, want 10", result.OutputSize)
+	}
+	if result.WallTime <= 0 {
+		t.Errorf("WallTime = %v, want > 0", result.WallTime)
+	}
+	if result.CPUTime() != result.UserTime+result.SystemTime {
+		t.Errorf("CPUTime() = %v, want %v", result.CPUTime(), result.UserTime+result.SystemTime)
+	}
+}
+
+func TestRunResultError(t *testing.T) {
+	fakeFFmpeg(t, `echo "in.mp4: No such file or directory" >&2; exit 1`)
+
+	result, err := New().Input("in.mp4").Output(filepath.Join(t.TempDir(), "out.mp4")).RunResult(context.Background())
+	if err == nil {
+		t.Fatal("RunResult() should fail")
+	}
+	if result == nil || result.OutputSize != 0 || result.Output != nil {
+		t.Errorf("RunResult() = %+v, want a result without output", result)
+	}
+
+	if result, err := New().RunResult(context.Background()); err == nil || result != nil {
+		t.Errorf("RunResult() of an invalid command = %v, %v, want nil and an error", result, err)
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	c := New().VideoCodec("libx265").Output("-")
+	result := newResult(c, nil, time.Second, Progress{Frame: 10, Speed: 1.5})
+	want := Result{VideoEncoder: "libx265", WallTime: time.Second, Frames: 10, Speed: 1.5}
+	if *result != want {
+		t.Errorf("newResult() = %+v, want %+v", *result, want)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package ffutil
+
+import "os"
+
+// peakRSS returns 0 on platforms that do not report resource usage.
+func peakRSS(ps *os.ProcessState) int64 {
+	return 0
+}
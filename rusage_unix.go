@@ -0,0 +1,23 @@
+//go:build unix
+
+package ffutil
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// peakRSS returns the maximum resident set size of a finished process in
+// bytes. Darwin reports ru_maxrss in bytes, other Unix systems in kilobytes.
+func peakRSS(ps *os.ProcessState) int64 {
+	rusage, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	maxRSS := int64(rusage.Maxrss) //nolint:unconvert // int32 on some platforms
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return maxRSS
+	}
+	return maxRSS * 1024
+}
@@ -0,0 +1,108 @@
+package ffutil
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scene represents a detected shot boundary.
+type Scene struct {
+	// Time is the timestamp of the first frame of the new shot
+	Time time.Duration `json:"time"`
+
+	// Score is the scene change score, from 0 to 1
+	Score float64 `json:"score"`
+}
+
+// SceneOptions configures scene change detection.
+type SceneOptions struct {
+	// Threshold is the minimum scene score to report a boundary,
+	// from 0 to 1 (default 0.4).
+	Threshold float64
+
+	// MinShotLength is the minimum time between reported boundaries
+	// in seconds. Boundaries closer than this to the previous one are dropped.
+	MinShotLength float64
+
+	// ScaleWidth downscales frames to this width before analysis
+	// to speed up detection. Zero analyzes frames at full size.
+	ScaleWidth int
+}
+
+// DetectScenes runs scene change detection and returns the shot boundaries.
+func DetectScenes(ctx context.Context, path string, opts SceneOptions) ([]Scene, error) {
+	output, err := New().
+		Input(path).
+		VideoFilter(sceneFilter(opts)).
+		NoAudio().
+		Args("-f", "null").
+		Output("-").
+		RunWithOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scenes := parseSceneLog(string(output))
+	return filterShortShots(scenes, secondsToDuration(opts.MinShotLength)), nil
+}
+
+func sceneFilter(opts SceneOptions) string {
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = 0.4
+	}
+	filter := fmt.Sprintf("select='gt(scene,%s)',metadata=print", formatFloat(threshold))
+	if opts.ScaleWidth > 0 {
+		filter = fmt.Sprintf("scale=%d:-2,", opts.ScaleWidth) + filter
+	}
+	return filter
+}
+
+// parseSceneLog extracts scenes from metadata=print log lines:
+//
+//	[Parsed_metadata_2 @ 0x...] frame:0    pts:3003    pts_time:3.003
+//	[Parsed_metadata_2 @ 0x...] lavfi.scene_score=0.532
+func parseSceneLog(log string) []Scene {
+	var scenes []Scene
+	var current *Scene
+	for _, line := range logLines(log) {
+		if !strings.Contains(line, "[Parsed_metadata") {
+			continue
+		}
+		if fields := logFields(line); len(fields) > 0 {
+			if t, ok := fields["pts_time"]; ok {
+				scenes = append(scenes, Scene{Time: t})
+				current = &scenes[len(scenes)-1]
+			}
+			continue
+		}
+		_, value, ok := strings.Cut(line, "lavfi.scene_score=")
+		if !ok || current == nil {
+			continue
+		}
+		if score, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			current.Score = score
+		}
+	}
+	return scenes
+}
+
+// filterShortShots drops boundaries that follow the previous kept boundary,
+// or the start of the media, by less than minLength.
+func filterShortShots(scenes []Scene, minLength time.Duration) []Scene {
+	if minLength <= 0 {
+		return scenes
+	}
+	var kept []Scene
+	var last time.Duration
+	for _, s := range scenes {
+		if s.Time-last < minLength {
+			continue
+		}
+		kept = append(kept, s)
+		last = s.Time
+	}
+	return kept
+}
@@ -0,0 +1,54 @@
+package ffutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSceneFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SceneOptions
+		want string
+	}{
+		{"defaults", SceneOptions{}, "select='gt(scene,0.4)',metadata=print"},
+		{"custom threshold", SceneOptions{Threshold: 0.25}, "select='gt(scene,0.25)',metadata=print"},
+		{"downscale", SceneOptions{ScaleWidth: 320}, "scale=320:-2,select='gt(scene,0.4)',metadata=print"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sceneFilter(tt.opts); got != tt.want {
+				t.Errorf("sceneFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSceneLog(t *testing.T) {
+	log := `[Parsed_metadata_2 @ 0x600] frame:0    pts:3003    pts_time:3.003
+[Parsed_metadata_2 @ 0x600] lavfi.scene_score=0.532
+[Parsed_metadata_2 @ 0x600] frame:1    pts:4004    pts_time:4.004
+[Parsed_metadata_2 @ 0x600] lavfi.scene_score=0.9
+[Parsed_metadata_2 @ 0x600] frame:2    pts:12012   pts_time:12.012
+[Parsed_metadata_2 @ 0x600] lavfi.scene_score=0.41
+`
+	scenes := parseSceneLog(log)
+	if len(scenes) != 3 {
+		t.Fatalf("parseSceneLog() returned %d scenes, want 3", len(scenes))
+	}
+
+	want := Scene{Time: 4004 * time.Millisecond, Score: 0.9}
+	if scenes[1] != want {
+		t.Errorf("parseSceneLog()[1] = %v, want %v", scenes[1], want)
+	}
+
+	kept := filterShortShots(scenes, 2*time.Second)
+	if len(kept) != 2 {
+		t.Fatalf("filterShortShots() kept %d scenes, want 2", len(kept))
+	}
+
+	if kept[1].Time != 12012*time.Millisecond {
+		t.Errorf("filterShortShots()[1].Time = %v, want 12.012s", kept[1].Time)
+	}
+}
@@ -0,0 +1,317 @@
+package ffutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrimOptions configures how a cut is made.
+type TrimOptions struct {
+	// Accurate re-encodes the output so cuts land exactly on the requested
+	// times. Otherwise streams are copied and each cut start is snapped to
+	// the preceding keyframe.
+	Accurate bool
+
+	// VideoCodec is the video codec for accurate cuts (default "libx264").
+	VideoCodec string
+
+	// AudioCodec is the audio codec for accurate cuts (default "aac").
+	AudioCodec string
+}
+
+// SplitOptions configures how a file is split into parts.
+// Exactly one of Times, SegmentLength or ByChapters must be set.
+type SplitOptions struct {
+	TrimOptions
+
+	// Times are the split points in seconds.
+	Times []float64
+
+	// SegmentLength splits into parts of this many seconds using the
+	// segment muxer.
+	SegmentLength float64
+
+	// ByChapters splits at the chapter boundaries of the input.
+	ByChapters bool
+
+	// Template is the output path template containing a single integer
+	// verb such as %d or %03d for the 1-based part number, with any other
+	// % written as %% (default "<input>_%03d<ext>").
+	Template string
+}
+
+// Segment is a file produced by Trim or Split.
+type Segment struct {
+	// Path is the output file path
+	Path string `json:"path"`
+
+	// Start is the start time of the part in the input
+	Start time.Duration `json:"start"`
+
+	// Duration is the actual duration of the output as reported by Probe
+	Duration time.Duration `json:"duration"`
+}
+
+// Trim cuts the section of input starting at start and lasting duration
+// seconds into output. A duration of 0 keeps everything after start.
+func Trim(ctx context.Context, input, output string, start, duration float64, opts TrimOptions) (*Segment, error) {
+	if !opts.Accurate && start > 0 {
+		keyframes, err := Keyframes(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		snapped := SnapToKeyframe(keyframes, secondsToDuration(start)).Seconds()
+		if duration > 0 {
+			duration += start - snapped
+		}
+		start = snapped
+	}
+
+	if err := trimCommand(input, output, start, duration, opts.withDefaults()).Run(ctx); err != nil {
+		return nil, err
+	}
+	return probeSegment(output, start)
+}
+
+// Split cuts input into consecutive parts and returns the produced files.
+func Split(ctx context.Context, input string, opts SplitOptions) ([]Segment, error) {
+	set := 0
+	for _, ok := range []bool{len(opts.Times) > 0, opts.SegmentLength > 0, opts.ByChapters} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of Times, SegmentLength or ByChapters must be set")
+	}
+
+	template := opts.Template
+	if template == "" {
+		template = defaultTemplate(input)
+	} else if err := checkTemplate(template); err != nil {
+		return nil, err
+	}
+
+	if opts.SegmentLength > 0 {
+		return splitSegments(ctx, input, template, opts)
+	}
+
+	times := opts.Times
+	if opts.ByChapters {
+		var err error
+		if times, err = chapterStarts(input); err != nil {
+			return nil, err
+		}
+	}
+	return splitAtTimes(ctx, input, template, times, opts.TrimOptions)
+}
+
+// defaultTemplate returns "<input>_%03d<ext>", with any % in the input
+// path escaped so it is kept literally.
+func defaultTemplate(input string) string {
+	ext := filepath.Ext(input)
+	escape := func(s string) string { return strings.ReplaceAll(s, "%", "%%") }
+	return escape(strings.TrimSuffix(input, ext)) + "_%03d" + escape(ext)
+}
+
+// checkTemplate verifies that template has exactly one integer verb, %d
+// with an optional zero-padded width, and that every other % is escaped.
+func checkTemplate(template string) error {
+	verbs := 0
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		j := i + 1
+		if j < len(template) && template[j] == '%' {
+			i = j
+			continue
+		}
+		for j < len(template) && template[j] >= '0' && template[j] <= '9' {
+			j++
+		}
+		if j == len(template) || template[j] != 'd' {
+			return fmt.Errorf("split template %q: %% must be followed by an integer verb such as %%03d or escaped as %%%%", template)
+		}
+		verbs++
+		i = j
+	}
+	if verbs != 1 {
+		return fmt.Errorf("split template %q must contain exactly one integer verb such as %%03d, found %d", template, verbs)
+	}
+	return nil
+}
+
+// withDefaults returns the options with default codecs applied.
+func (o TrimOptions) withDefaults() TrimOptions {
+	if o.Accurate {
+		if o.VideoCodec == "" {
+			o.VideoCodec = "libx264"
+		}
+		if o.AudioCodec == "" {
+			o.AudioCodec = "aac"
+		}
+	}
+	return o
+}
+
+// trimCommand builds the command for a single cut. Stream copies keep
+// every stream of the input.
+func trimCommand(input, output string, start, duration float64, opts TrimOptions) *Command {
+	cmd := New().InputWithStartTime(input, start).Output(output)
+	if duration > 0 {
+		cmd.Duration(duration)
+	}
+	if opts.Accurate {
+		return cmd.VideoCodec(opts.VideoCodec).AudioCodec(opts.AudioCodec)
+	}
+	return cmd.Map("0").CopyVideo().CopyAudio().Args("-c:s", "copy", "-avoid_negative_ts", "make_zero")
+}
+
+// segmentCommand builds a command that splits input into fixed-length
+// parts with the segment muxer, writing the part list to listPath.
+func segmentCommand(input, template, listPath string, opts SplitOptions) *Command {
+	length := formatDuration(opts.SegmentLength)
+	cmd := New().Input(input).Output(template)
+	if opts.Accurate {
+		cmd.VideoCodec(opts.VideoCodec).
+			AudioCodec(opts.AudioCodec).
+			Args("-force_key_frames", "expr:gte(t,n_forced*"+length+")")
+	} else {
+		cmd.Map("0").CopyVideo().CopyAudio().Args("-c:s", "copy")
+	}
+	return cmd.Args(
+		"-f", "segment",
+		"-segment_time", length,
+		"-segment_start_number", "1",
+		"-segment_list", listPath,
+		"-segment_list_type", "csv",
+		"-reset_timestamps", "1",
+	)
+}
+
+func splitSegments(ctx context.Context, input, template string, opts SplitOptions) ([]Segment, error) {
+	opts.TrimOptions = opts.withDefaults()
+
+	list, err := os.CreateTemp("", "ffutil-segments-*.csv")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create segment list: %w", err)
+	}
+	list.Close()
+	defer os.Remove(list.Name())
+
+	if err := segmentCommand(input, template, list.Name(), opts).Run(ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(list.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment list: %w", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse segment list: %w", err)
+	}
+
+	// The segment list contains base names in the template directory.
+	dir := filepath.Dir(template)
+	var segments []Segment
+	for _, rec := range records {
+		if len(rec) < 2 {
+			continue
+		}
+		start, _ := strconv.ParseFloat(rec[1], 64)
+		seg, err := probeSegment(filepath.Join(dir, rec[0]), start)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, *seg)
+	}
+	return segments, nil
+}
+
+func splitAtTimes(ctx context.Context, input, template string, times []float64, opts TrimOptions) ([]Segment, error) {
+	opts = opts.withDefaults()
+
+	points := []float64{0}
+	points = append(points, times...)
+	if !opts.Accurate {
+		keyframes, err := Keyframes(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range points {
+			points[i] = SnapToKeyframe(keyframes, secondsToDuration(t)).Seconds()
+		}
+	}
+	points = uniqueSorted(points)
+
+	var segments []Segment
+	for i, start := range points {
+		var duration float64
+		if i+1 < len(points) {
+			duration = points[i+1] - start
+		}
+		output := fmt.Sprintf(template, i+1)
+		if err := trimCommand(input, output, start, duration, opts).Run(ctx); err != nil {
+			return nil, err
+		}
+		seg, err := probeSegment(output, start)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, *seg)
+	}
+	return segments, nil
+}
+
+func probeSegment(path string, start float64) (*Segment, error) {
+	info, err := Probe(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Segment{
+		Path:     path,
+		Start:    secondsToDuration(start),
+		Duration: info.Duration,
+	}, nil
+}
+
+// uniqueSorted returns the non-negative values sorted with duplicates removed.
+func uniqueSorted(values []float64) []float64 {
+	sort.Float64s(values)
+	var out []float64
+	for _, v := range values {
+		if v < 0 || (len(out) > 0 && v == out[len(out)-1]) {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// chapterStarts returns the start times in seconds of all chapters after the first.
+func chapterStarts(path string) ([]float64, error) {
+	info, err := Probe(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found in %s", path)
+	}
+
+	var starts []float64
+	for _, ch := range info.Chapters[1:] {
+		starts = append(starts, ch.Start.Seconds())
+	}
+	return starts, nil
+}
@@ -0,0 +1,131 @@
+package ffutil
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTrimCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmd         *Command
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "stream copy",
+			cmd:      trimCommand("in.mp4", "out.mp4", 12, 30, TrimOptions{}.withDefaults()),
+			contains: []string{"-ss 12.000 -i in.mp4", "-map 0", "-c:v copy", "-c:a copy", "-c:s copy", "-t 30.000", "-avoid_negative_ts make_zero"},
+		},
+		{
+			name:        "accurate",
+			cmd:         trimCommand("in.mp4", "out.mp4", 12, 0, TrimOptions{Accurate: true}.withDefaults()),
+			contains:    []string{"-ss 12.000 -i in.mp4", "-c:v libx264", "-c:a aac"},
+			notContains: []string{"-t ", "copy", "-map"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := strings.Join(tt.cmd.Build(), " ")
+			for _, want := range tt.contains {
+				if !strings.Contains(args, want) {
+					t.Errorf("trimCommand() missing %q in %s", want, args)
+				}
+			}
+			for _, notWant := range tt.notContains {
+				if strings.Contains(args, notWant) {
+					t.Errorf("trimCommand() should not contain %q in %s", notWant, args)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentCommand(t *testing.T) {
+	opts := SplitOptions{SegmentLength: 60}
+	opts.Accurate = true
+	opts.TrimOptions = opts.withDefaults()
+
+	args := strings.Join(segmentCommand("in.mp4", "part_%03d.mp4", "list.csv", opts).Build(), " ")
+	wants := []string{
+		"-force_key_frames expr:gte(t,n_forced*60.000)",
+		"-f segment -segment_time 60.000",
+		"-segment_list list.csv -segment_list_type csv",
+		"part_%03d.mp4",
+	}
+	for _, want := range wants {
+		if !strings.Contains(args, want) {
+			t.Errorf("segmentCommand() missing %q in %s", want, args)
+		}
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	tests := map[string]string{
+		"/media/in.mp4":       "/media/in_%03d.mp4",
+		"/media/100% fun.mp4": "/media/100%% fun_%03d.mp4",
+		"clip%d":              "clip%%d_%03d",
+	}
+	for input, want := range tests {
+		got := defaultTemplate(input)
+		if got != want {
+			t.Errorf("defaultTemplate(%q) = %q, want %q", input, got, want)
+		}
+		if part := fmt.Sprintf(got, 1); !strings.HasPrefix(part, strings.TrimSuffix(input, filepath.Ext(input))) {
+			t.Errorf("part name %q should start with the input name", part)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{"part_%d.mp4", true},
+		{"part_%03d.mp4", true},
+		{"100%%_%02d.mp4", true},
+		{"part.mp4", false},
+		{"part_%s.mp4", false},
+		{"part_%d_%d.mp4", false},
+		{"100%_%d.mp4", false},
+		{"part_%", false},
+	}
+	for _, tt := range tests {
+		if err := checkTemplate(tt.template); (err == nil) != tt.valid {
+			t.Errorf("checkTemplate(%q) = %v, want valid %v", tt.template, err, tt.valid)
+		}
+	}
+	for _, input := range []string{"in.mp4", "/media/100% fun.mp4"} {
+		if err := checkTemplate(defaultTemplate(input)); err != nil {
+			t.Errorf("default template of %q: %v", input, err)
+		}
+	}
+
+	if _, err := Split(context.Background(), "in.mp4", SplitOptions{Times: []float64{10}, Template: "part.mp4"}); err == nil {
+		t.Error("Split() should fail for a template without a verb")
+	}
+}
+
+func TestSplitRequiresOneMode(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Split(ctx, "in.mp4", SplitOptions{}); err == nil {
+		t.Error("Split() should fail when no split mode is set")
+	}
+	if _, err := Split(ctx, "in.mp4", SplitOptions{Times: []float64{10}, SegmentLength: 60}); err == nil {
+		t.Error("Split() should fail when several split modes are set")
+	}
+}
+
+func TestUniqueSorted(t *testing.T) {
+	got := uniqueSorted([]float64{10, 0, 4, 10, -1, 4})
+	want := []float64{0, 4, 10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueSorted() = %v, want %v", got, want)
+	}
+}
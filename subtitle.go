@@ -0,0 +1,133 @@
+package ffutil
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// subtitleTrack is a subtitle file added to a command as a soft track.
+type subtitleTrack struct {
+	input    int
+	path     string
+	language string
+}
+
+// SubtitlesFilter returns a subtitles filter that renders the given file,
+// with the path escaped for use in a filter graph.
+func SubtitlesFilter(path string) string {
+	return "subtitles=" + escapeFilterValue(path)
+}
+
+// ExtractSubtitles writes the subtitle stream with the given index among
+// the input's subtitle streams (0 for the first) to output. The output
+// format is chosen from its extension (.srt, .vtt or .ass).
+func ExtractSubtitles(ctx context.Context, input string, index int, output string) error {
+	cmd := New().
+		Input(input).
+		Map(fmt.Sprintf("0:s:%d", index)).
+		Output(output)
+	if codec := subtitleCodecFor(output, ""); codec != "" {
+		cmd.SubtitleCodec(codec)
+	}
+	return cmd.Run(ctx)
+}
+
+// ConvertSubtitles converts a subtitle file between SRT, WebVTT and ASS
+// based on the file extensions.
+func ConvertSubtitles(ctx context.Context, input, output string) error {
+	codec := subtitleCodecFor(output, input)
+	if codec == "" {
+		return fmt.Errorf("unsupported subtitle format: %s", filepath.Ext(output))
+	}
+	return New().
+		Input(input).
+		SubtitleCodec(codec).
+		Output(output).
+		Run(ctx)
+}
+
+// sourceSubtitleCodec returns the codec for subtitle streams kept from the
+// inputs: stream copy for Matroska, which stores any subtitle format, and
+// the container's text codec otherwise.
+func sourceSubtitleCodec(output string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mkv", ".mka":
+		return "copy"
+	}
+	return subtitleCodecFor(output, "")
+}
+
+// streamMaps returns the -map values, adding the defaults for cover art
+// and subtitle tracks, and reports whether streams other than the subtitle
+// tracks may be subtitles. Subtitle tracks are mapped before the first map
+// that may select subtitle streams, so they are always the first output
+// subtitle streams.
+func (c *Command) streamMaps() (maps []string, sourceSubtitles bool) {
+	maps = slices.Clone(c.maps)
+	if c.coverArt != nil {
+		if len(maps) == 0 {
+			maps = []string{"0:a"}
+		}
+		maps = append(maps, fmt.Sprintf("%d:v", c.coverArt.input))
+	}
+	if len(c.subtitles) == 0 {
+		return maps, false
+	}
+	if len(maps) == 0 {
+		maps = []string{"0:v?", "0:a?", "0:s?"}
+	}
+
+	tracks := make([]string, len(c.subtitles))
+	for i, sub := range c.subtitles {
+		tracks[i] = fmt.Sprintf("%d:s", sub.input)
+	}
+	i := slices.IndexFunc(maps, mapMaySelectSubtitles)
+	if i < 0 {
+		return append(maps, tracks...), false
+	}
+	return slices.Insert(maps, i, tracks...), true
+}
+
+// mapMaySelectSubtitles reports whether a -map value may select subtitle
+// streams. Negative maps and filter graph outputs never do, and neither do
+// specifiers for video, audio, data or attachment streams.
+func mapMaySelectSubtitles(spec string) bool {
+	if strings.HasPrefix(spec, "-") || strings.HasPrefix(spec, "[") {
+		return false
+	}
+	_, stream, ok := strings.Cut(spec, ":")
+	if !ok || stream == "" {
+		return true // all streams of an input
+	}
+	switch stream[0] {
+	case 'v', 'V', 'a', 'd', 't':
+		return false
+	}
+	return true
+}
+
+// subtitleCodecFor returns the subtitle codec suited to the output
+// container, or "" if unknown. The source path is used to keep ASS styling
+// in Matroska outputs.
+func subtitleCodecFor(output, source string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mp4", ".m4v", ".mov":
+		return "mov_text"
+	case ".webm", ".m3u8", ".vtt":
+		return "webvtt"
+	case ".mkv", ".mka":
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".ass", ".ssa":
+			return "ass"
+		}
+		return "srt"
+	case ".srt":
+		return "srt"
+	case ".ass", ".ssa":
+		return "ass"
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package ffutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubtitleCodecFor(t *testing.T) {
+	tests := []struct {
+		output string
+		source string
+		want   string
+	}{
+		{"out.mp4", "subs.srt", "mov_text"},
+		{"out.MOV", "subs.srt", "mov_text"},
+		{"out.m3u8", "subs.srt", "webvtt"},
+		{"out.mkv", "subs.srt", "srt"},
+		{"out.mkv", "subs.ass", "ass"},
+		{"out.vtt", "subs.srt", "webvtt"},
+		{"out.avi", "subs.srt", ""},
+	}
+
+	for _, tt := range tests {
+		if got := subtitleCodecFor(tt.output, tt.source); got != tt.want {
+			t.Errorf("subtitleCodecFor(%q, %q) = %q, want %q", tt.output, tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestBurnSubtitles(t *testing.T) {
+	args := New().
+		Input("input.mp4").
+		VideoFilter("scale=1280:-2").
+		BurnSubtitles("/subs/it's here.srt").
+		Output("output.mp4").
+		Build()
+
+	want := `scale=1280:-2,subtitles=/subs/it\\\'s here.srt`
+	if !strings.Contains(strings.Join(args, "|"), "-vf|"+want) {
+		t.Errorf("BurnSubtitles() args = %v, want -vf %s", args, want)
+	}
+}
+
+func TestSubtitleTrack(t *testing.T) {
+	args := strings.Join(New().
+		Input("input.mp4").
+		SubtitleTrack("en.srt", "eng").
+		SubtitleTrack("fr.srt", "fra").
+		CopyVideo().
+		CopyAudio().
+		Output("output.mp4").
+		Build(), " ")
+
+	wants := []string{
+		"-i input.mp4 -i en.srt -i fr.srt",
+		"-map 0:v? -map 0:a? -map 1:s -map 2:s -map 0:s?",
+		"-c:s mov_text -c:s:0 mov_text -c:s:1 mov_text",
+		"-metadata:s:s:0 language=eng",
+		"-metadata:s:s:1 language=fra",
+	}
+	for _, want := range wants {
+		if !strings.Contains(args, want) {
+			t.Errorf("SubtitleTrack() missing %q in %s", want, args)
+		}
+	}
+}
+
+func TestSubtitleTrackWithMap(t *testing.T) {
+	args := strings.Join(New().
+		Input("input.mkv").
+		Map("0").
+		SubtitleTrack("en.ass", "").
+		Output("output.mkv").
+		Build(), " ")
+
+	if !strings.Contains(args, "-map 1:s -map 0") || !strings.Contains(args, "-c:s copy -c:s:0 ass") {
+		t.Errorf("SubtitleTrack() with Map args = %s", args)
+	}
+	if strings.Contains(args, "0:v?") || strings.Contains(args, "language=") {
+		t.Errorf("SubtitleTrack() with Map should not add default maps or language: %s", args)
+	}
+}
+
+func TestSubtitleTracksWithMappedSubtitles(t *testing.T) {
+	args := strings.Join(New().
+		Input("input.mkv").
+		Map("0:v").
+		Map("0:a:0").
+		Map("0:s:1").
+		SubtitleTrack("en.ass", "eng").
+		SubtitleTrack("fr.srt", "fra").
+		Output("output.mkv").
+		Build(), " ")
+
+	wants := []string{
+		"-map 0:v -map 0:a:0 -map 1:s -map 2:s -map 0:s:1",
+		"-c:s copy -c:s:0 ass -c:s:1 srt",
+		"-metadata:s:s:0 language=eng -metadata:s:s:1 language=fra",
+	}
+	for _, want := range wants {
+		if !strings.Contains(args, want) {
+			t.Errorf("SubtitleTrack() with Map missing %q in %s", want, args)
+		}
+	}
+}
+
+func TestMapMaySelectSubtitles(t *testing.T) {
+	tests := map[string]bool{
+		"0":                true,
+		"0:s":              true,
+		"0:s:1?":           true,
+		"1:m:language:eng": true,
+		"0:v":              false,
+		"0:a:0":            false,
+		"0:V?":             false,
+		"[v]":              false,
+		"-0:s":             false,
+	}
+	for spec, want := range tests {
+		if got := mapMaySelectSubtitles(spec); got != want {
+			t.Errorf("mapMaySelectSubtitles(%q) = %v, want %v", spec, got, want)
+		}
+	}
+}
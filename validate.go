@@ -0,0 +1,294 @@
+package ffutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateOptions enables optional checks in ValidateWith.
+type ValidateOptions struct {
+	// CheckEncoders verifies that the video, audio and subtitle codecs are
+	// available in the installed ffmpeg. This runs "ffmpeg -encoders".
+	CheckEncoders bool
+
+	// CheckContainer verifies that the codecs are supported by the output
+	// container, as inferred from the output file extension.
+	CheckContainer bool
+}
+
+// Validate checks the command for missing or contradictory settings, such
+// as NoAudio with AudioBitrate or CopyVideo with a video filter.
+// All problems are returned as a joined error.
+func (c *Command) Validate() error {
+	return c.ValidateWith(ValidateOptions{})
+}
+
+// ValidateWith checks the command like Validate and runs the optional checks
+// enabled in opts.
+func (c *Command) ValidateWith(opts ValidateOptions) error {
+	errs := c.validateArgs()
+	if opts.CheckContainer {
+		errs = append(errs, c.validateContainer()...)
+	}
+	if opts.CheckEncoders {
+		errs = append(errs, c.validateEncoders()...)
+	}
+	return errors.Join(errs...)
+}
+
+// SkipValidation disables the validation Run performs before executing.
+func (c *Command) SkipValidation() *Command {
+	c.skipValidation = true
+	return c
+}
+
+func (c *Command) validateArgs() []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.inputs) == 0 {
+		add("no inputs")
+	}
+	for i, in := range c.inputs {
+		if in.path == "" {
+			add("input %d has an empty path", i)
+		}
+	}
+	if c.outputPath == "" {
+		add("no output")
+	}
+
+	if (c.width > 0) != (c.height > 0) {
+		add("Size requires both width and height, got %dx%d", c.width, c.height)
+	}
+	if c.width < 0 || c.height < 0 {
+		add("Size must not be negative, got %dx%d", c.width, c.height)
+	}
+	if c.crf < 0 {
+		add("CRF must not be negative, got %d", c.crf)
+	}
+	if c.fps < 0 || c.audioRate < 0 || c.channels < 0 {
+		add("FPS, AudioRate and Channels must not be negative")
+	}
+	if c.duration < 0 || c.startTime < 0 {
+		add("Duration and StartTime must not be negative")
+	}
+	if c.threads < 0 || c.filterThreads < 0 || c.filterComplexThreads < 0 {
+		add("Threads, FilterThreads and FilterComplexThreads must not be negative")
+	}
+	if c.logLevel != "" && !validLogLevel(c.logLevel) {
+		add("unknown LogLevel %q", c.logLevel)
+	}
+	if c.atomicOutput && c.outputPath != "" && !isFileOutput(c.outputPath) {
+		add("AtomicOutput requires a file output, got %q", c.outputPath)
+	}
+	if c.gracePeriod < 0 {
+		add("GracePeriod must not be negative, got %v", c.gracePeriod)
+	}
+	if c.stderrLimit < 0 {
+		add("StderrLimit must not be negative, got %d", c.stderrLimit)
+	}
+
+	videoSettings := c.videoSettings()
+	audioSettings := c.audioSettings()
+
+	if c.noVideo {
+		if c.copyVideo {
+			add("NoVideo conflicts with CopyVideo")
+		}
+		if c.videoCodec != "" {
+			add("NoVideo conflicts with VideoCodec")
+		}
+		if c.coverArt != nil {
+			add("NoVideo conflicts with CoverArt")
+		}
+		if c.hwaccel != nil {
+			add("NoVideo conflicts with HWAccel")
+		}
+		for _, name := range videoSettings {
+			add("NoVideo conflicts with %s", name)
+		}
+	} else if c.copyVideo {
+		if c.hwaccel != nil {
+			add("CopyVideo conflicts with HWAccel")
+		}
+		for _, name := range videoSettings {
+			add("CopyVideo conflicts with %s, which requires re-encoding", name)
+		}
+	}
+
+	if c.hwaccel != nil && c.filterComplex != "" {
+		add("FilterComplex conflicts with HWAccel, which sets the video filter")
+	}
+
+	if c.noAudio {
+		if c.copyAudio {
+			add("NoAudio conflicts with CopyAudio")
+		}
+		if c.audioCodec != "" {
+			add("NoAudio conflicts with AudioCodec")
+		}
+		for _, name := range audioSettings {
+			add("NoAudio conflicts with %s", name)
+		}
+	} else if c.copyAudio {
+		for _, name := range audioSettings {
+			add("CopyAudio conflicts with %s, which requires re-encoding", name)
+		}
+	}
+
+	if c.noVideo && c.noAudio && len(c.subtitles) == 0 && len(c.maps) == 0 {
+		add("NoVideo and NoAudio leave no streams to output")
+	}
+	return errs
+}
+
+// videoSettings returns the names of the video encoding settings in use.
+func (c *Command) videoSettings() []string {
+	var names []string
+	if c.width > 0 || c.height > 0 {
+		names = append(names, "Size")
+	}
+	if c.fps > 0 {
+		names = append(names, "FPS")
+	}
+	if c.crf > 0 {
+		names = append(names, "CRF")
+	}
+	if c.preset != "" {
+		names = append(names, "Preset")
+	}
+	if c.pixelFormat != "" {
+		names = append(names, "PixelFormat")
+	}
+	if c.videoBitrate != "" {
+		names = append(names, "VideoBitrate")
+	}
+	if c.filterVideo != "" {
+		names = append(names, "VideoFilter")
+	}
+	return names
+}
+
+// audioSettings returns the names of the audio encoding settings in use.
+func (c *Command) audioSettings() []string {
+	var names []string
+	if c.audioBitrate != "" {
+		names = append(names, "AudioBitrate")
+	}
+	if c.audioRate > 0 {
+		names = append(names, "AudioRate")
+	}
+	if c.channels > 0 {
+		names = append(names, "Channels")
+	}
+	if c.filterAudio != "" {
+		names = append(names, "AudioFilter")
+	}
+	return names
+}
+
+// containerCodecs lists the encoders each output container accepts, by
+// name or name prefix. Containers not listed accept any codec, and a nil
+// list accepts any codec for that stream type.
+var containerCodecs = map[string]struct {
+	video []string
+	audio []string
+}{
+	".mp4":  {video: []string{"libx264", "h264_", "libx265", "hevc_", "libaom-av1", "libsvtav1", "av1_", "mpeg4", "libvpx-vp9", "mjpeg", "png"}, audio: []string{"aac", "libfdk_aac", "libmp3lame", "ac3", "eac3", "alac", "flac", "libopus"}},
+	".m4a":  {video: []string{"mjpeg", "png"}, audio: []string{"aac", "libfdk_aac", "alac"}},
+	".webm": {video: []string{"libvpx", "libvpx-vp9", "libaom-av1", "libsvtav1", "av1_"}, audio: []string{"libopus", "libvorbis"}},
+	".mp3":  {video: []string{"mjpeg", "png"}, audio: []string{"libmp3lame", "libshine"}},
+	".ogg":  {video: []string{"libtheora"}, audio: []string{"libvorbis", "libopus", "flac"}},
+	".opus": {video: []string{}, audio: []string{"libopus"}},
+	".flac": {video: []string{"mjpeg", "png"}, audio: []string{"flac"}},
+	".wav":  {video: []string{}, audio: []string{"pcm_"}},
+	".gif":  {video: []string{"gif"}, audio: []string{}},
+}
+
+func (c *Command) validateContainer() []error {
+	ext := strings.ToLower(filepath.Ext(c.outputPath))
+	allowed, ok := containerCodecs[ext]
+	if !ok {
+		return nil
+	}
+
+	var errs []error
+	check := func(kind, codec string, list []string) {
+		if codec == "" || list == nil {
+			return
+		}
+		for _, name := range list {
+			if codec == name || (strings.HasSuffix(name, "_") && strings.HasPrefix(codec, name)) {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s codec %s is not supported in %s output", kind, codec, ext))
+	}
+	if !c.noVideo {
+		check("video", c.videoCodec, allowed.video)
+	}
+	if !c.noAudio {
+		check("audio", c.audioCodec, allowed.audio)
+	}
+	return errs
+}
+
+func (c *Command) validateEncoders() []error {
+	available, err := encoderNames()
+	if err != nil {
+		return []error{fmt.Errorf("failed to list encoders: %w", err)}
+	}
+
+	var errs []error
+	check := func(kind, codec string) {
+		if codec != "" && codec != "copy" && !available[codec] {
+			errs = append(errs, fmt.Errorf("%s encoder %s is not available", kind, codec))
+		}
+	}
+	if !c.noVideo {
+		check("video", c.videoCodec)
+	}
+	if !c.noAudio {
+		check("audio", c.audioCodec)
+	}
+	check("subtitle", c.subtitleCodec)
+	return errs
+}
+
+// encoderNames returns the names of all encoders (video, audio and
+// subtitle) supported by the installed ffmpeg.
+func encoderNames() (map[string]bool, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return parseEncoderNames(stdout.String()), nil
+}
+
+// parseEncoderNames parses the output of "ffmpeg -encoders". Encoder lines
+// start with capability flags such as "V....D" or "A....." followed by
+// the encoder name.
+func parseEncoderNames(output string) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields[0]) != 6 || !strings.ContainsAny(fields[0][:1], "VAS") {
+			continue
+		}
+		if fields[1] == "=" { // legend line such as "V..... = Video"
+			continue
+		}
+		names[fields[1]] = true
+	}
+	return names
+}
@@ -0,0 +1,131 @@
+package ffutil
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+		errs []string
+	}{
+		{
+			name: "valid transcode",
+			cmd:  New().Input("in.mp4").VideoCodec("libx264").CRF(23).AudioCodec("aac").Output("out.mp4"),
+		},
+		{
+			name: "missing input and output",
+			cmd:  New().VideoCodec("libx264"),
+			errs: []string{"no inputs", "no output"},
+		},
+		{
+			name: "no audio with audio settings",
+			cmd:  New().Input("in.mp4").NoAudio().AudioBitrate("128k").AudioCodec("aac").Output("out.mp4"),
+			errs: []string{"NoAudio conflicts with AudioCodec", "NoAudio conflicts with AudioBitrate"},
+		},
+		{
+			name: "copy video with encoding settings",
+			cmd:  New().Input("in.mp4").CopyVideo().Size(1280, 720).VideoFilter("hflip").CRF(20).Output("out.mp4"),
+			errs: []string{
+				"CopyVideo conflicts with Size",
+				"CopyVideo conflicts with CRF",
+				"CopyVideo conflicts with VideoFilter",
+			},
+		},
+		{
+			name: "size with only width",
+			cmd:  New().Input("in.mp4").Size(1280, 0).Output("out.mp4"),
+			errs: []string{"Size requires both width and height"},
+		},
+		{
+			name: "unknown log level",
+			cmd:  New().Input("in.mp4").LogLevel("loud").StderrLimit(-1).Output("out.mp4"),
+			errs: []string{`unknown LogLevel "loud"`, "StderrLimit must not be negative"},
+		},
+		{
+			name: "atomic output to a pipe",
+			cmd:  New().Input("in.mp4").AtomicOutput().Output("pipe:1"),
+			errs: []string{`AtomicOutput requires a file output, got "pipe:1"`},
+		},
+		{
+			name: "hwaccel with filter complex",
+			cmd:  New().Input("in.mp4").HWAccel(CommonEncoders.H264VAAPI).FilterComplex("[0:v]hflip[v]").Map("[v]").Output("out.mp4"),
+			errs: []string{"FilterComplex conflicts with HWAccel"},
+		},
+		{
+			name: "no streams",
+			cmd:  New().Input("in.mp4").NoVideo().NoAudio().Output("out.mp4"),
+			errs: []string{"leave no streams"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cmd.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %v", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error missing %q in:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateContainer(t *testing.T) {
+	opts := ValidateOptions{CheckContainer: true}
+
+	ok := New().Input("in.mov").VideoCodec("h264_nvenc").AudioCodec("aac").Output("out.mp4")
+	if err := ok.ValidateWith(opts); err != nil {
+		t.Errorf("ValidateWith() error = %v, want nil", err)
+	}
+
+	bad := New().Input("in.mov").VideoCodec("libx264").AudioCodec("aac").Output("out.webm")
+	err := bad.ValidateWith(opts)
+	if err == nil {
+		t.Fatal("ValidateWith() should reject libx264/aac in webm")
+	}
+	for _, want := range []string{"video codec libx264", "audio codec aac"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateWith() error missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseEncoderNames(t *testing.T) {
+	output := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+ S..... mov_text             3GPP Timed Text subtitle
+`
+	names := parseEncoderNames(output)
+	for _, want := range []string{"libx264", "aac", "mov_text"} {
+		if !names[want] {
+			t.Errorf("parseEncoderNames() missing %s", want)
+		}
+	}
+	if names["="] || len(names) != 3 {
+		t.Errorf("parseEncoderNames() = %v, want 3 encoders", names)
+	}
+}
+
+func TestRunValidatesByDefault(t *testing.T) {
+	err := New().Input("in.mp4").CopyVideo().CRF(20).Output("out.mp4").Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid ffmpeg command") {
+		t.Errorf("Run() error = %v, want validation error", err)
+	}
+}